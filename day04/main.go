@@ -2,9 +2,11 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 type Grid struct {
@@ -21,6 +23,17 @@ func (grid *Grid) InBounds(x int, y int) bool {
 	return x >= 0 && x < grid.width && y >= 0 && y < grid.height
 }
 
+/**
+ * Returns the character at (x, y), or 0 if the point lies outside of the grid.
+ */
+func (grid *Grid) At(x int, y int) rune {
+	if !grid.InBounds(x, y) {
+		return 0
+	}
+
+	return grid.contents[grid.ToIndex(x, y)]
+}
+
 /**
  * Recursively searches for the remainder of the word "XMAS" by looking in the given direction.
  */
@@ -42,109 +55,182 @@ func SearchNext(x int, y int, xdir int, ydir int, prev rune, grid *Grid) int {
 	return 0
 }
 
+/**
+ * A single occurrence of a word in the grid. The cells are listed in reading order of the word, and
+ * the direction indexes the table of directions used by whichever search produced the match.
+ */
+type Match struct {
+	cells     []Point
+	direction int
+}
+
+type Point struct {
+	x int
+	y int
+}
+
+// An "XMAS" may appear in any of the 8 directions, outwardly from the 'X'.
+var xmasDirections = []Point{{1, 0}, {0, 1}, {1, 1}, {0, -1}, {-1, 0}, {1, -1}, {-1, 1}, {-1, -1}}
+
+// The side of the "X-MAS" on which both 'M's sit.
+const (
+	MAS_TOP    = 0
+	MAS_RIGHT  = 1
+	MAS_BOTTOM = 2
+	MAS_LEFT   = 3
+)
+
+/**
+ * Returns every "XMAS" that starts from the 'X' at (x, y).
+ */
+func FindXMAS(x int, y int, grid *Grid) []Match {
+	if grid.At(x, y) != 'X' {
+		return nil
+	}
+
+	matches := make([]Match, 0)
+	for i, dir := range xmasDirections {
+		if SearchNext(x, y, dir.x, dir.y, 'X', grid) == 0 {
+			continue
+		}
+
+		cells := make([]Point, len("XMAS"))
+		for step := range cells {
+			cells[step] = Point{x + step*dir.x, y + step*dir.y}
+		}
+		matches = append(matches, Match{cells: cells, direction: i})
+	}
+
+	return matches
+}
+
 func Search(x int, y int, grid *Grid) int {
-	character := grid.contents[grid.ToIndex(x, y)]
-
-	count := 0
-	if character == 'X' {
-		// An "XMAS" may appear in any of the 8 directions, outwardly from the 'X'.
-		count += SearchNext(x, y, 1, 0, 'X', grid)
-		count += SearchNext(x, y, 0, 1, 'X', grid)
-		count += SearchNext(x, y, 1, 1, 'X', grid)
-		count += SearchNext(x, y, 0, -1, 'X', grid)
-		count += SearchNext(x, y, -1, 0, 'X', grid)
-		count += SearchNext(x, y, 1, -1, 'X', grid)
-		count += SearchNext(x, y, -1, 1, 'X', grid)
-		count += SearchNext(x, y, -1, -1, 'X', grid)
-	}
-
-	return count
+	return len(FindXMAS(x, y, grid))
 }
 
 /**
  * Assuming that the point at (x, y) contains an 'A'. Check the diagonally-adjacent cells for
- * instances of the word "MAS". Returns the number of times it occurs
+ * instances of the word "MAS" and return the matching X-shape, if there is one.
  */
-func CheckMAS(x int, y int, grid *Grid) int {
-	if grid.contents[grid.ToIndex(x, y)] != 'A' {
-		return 0
+func FindMAS(x int, y int, grid *Grid) []Match {
+	if grid.At(x, y) != 'A' {
+		return nil
 	}
 
-	above := grid.contents[grid.ToIndex(x-1, y-1)]
-	below := grid.contents[grid.ToIndex(x+1, y+1)]
+	above := grid.At(x-1, y-1)
+	below := grid.At(x+1, y+1)
 
 	if !((above == 'M' && below == 'S') || (above == 'S' && below == 'M')) {
-		return 0
+		return nil
 	}
 
-	above = grid.contents[grid.ToIndex(x+1, y-1)]
-	below = grid.contents[grid.ToIndex(x-1, y+1)]
+	above = grid.At(x+1, y-1)
+	below = grid.At(x-1, y+1)
 
-	if (above == 'M' && below == 'S') || (above == 'S' && below == 'M') {
-		return 1
+	if !((above == 'M' && below == 'S') || (above == 'S' && below == 'M')) {
+		return nil
 	}
 
-	return 0
+	// Classify the match by where the two 'M's sit relative to the 'A'.
+	leftM := grid.At(x-1, y-1) == 'M'
+	rightM := grid.At(x+1, y-1) == 'M'
+	var direction int
+	switch {
+	case leftM && rightM:
+		direction = MAS_TOP
+	case leftM:
+		direction = MAS_LEFT
+	case rightM:
+		direction = MAS_RIGHT
+	default:
+		direction = MAS_BOTTOM
+	}
+
+	cells := []Point{{x - 1, y - 1}, {x + 1, y - 1}, {x, y}, {x - 1, y + 1}, {x + 1, y + 1}}
+	return []Match{{cells: cells, direction: direction}}
 }
 
-func SearchGrid(grid *Grid) int {
-	// By changing these variables and the SearchFunc, I can easily switch between
-	// the words I'm searching for.
-	var (
-		xStart int = 1
-		xEnd   int = grid.width - 1
-		yStart int = 1
-		yEnd   int = grid.height - 1
-	)
-
-	SearchFunc := CheckMAS
-
-	numFound := 0
-	for y := yStart; y < yEnd; y++ {
-		for x := xStart; x < xEnd; x++ {
-			numFound += SearchFunc(x, y, grid)
+/**
+ * Returns the number of times "MAS" appears in the shape of an X centred on (x, y).
+ */
+func CheckMAS(x int, y int, grid *Grid) int {
+	return len(FindMAS(x, y, grid))
+}
+
+/**
+ * Collects the matches found by the given search function at every cell of the grid. Both search
+ * functions are bounds-checked, so every cell can be visited.
+ */
+func SearchGrid(grid *Grid, FindFunc func(int, int, *Grid) []Match) []Match {
+	matches := make([]Match, 0)
+	for y := 0; y < grid.height; y++ {
+		for x := 0; x < grid.width; x++ {
+			matches = append(matches, FindFunc(x, y, grid)...)
 		}
 	}
 
-	return numFound
+	return matches
 }
 
-func PopulateGridFromReader(r *bufio.Reader) Grid {
+/**
+ * Reads a rectangular grid of characters. Accepts both "\n" and "\r\n" line endings and a missing
+ * newline at the end of the final row. Returns an error if the rows are not all the same width, or if
+ * an empty line comes before the last row.
+ */
+func PopulateGridFromReader(r *bufio.Reader) (Grid, error) {
 	grid := Grid{contents: make([]rune, 0, 128)}
 
-	width := 0
-	height := 0
-	chCount := 0
-
-	for {
-		ch, _, err := r.ReadRune()
-		ch = rune(ch)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			panic(err)
+	blankLine := 0 // The first empty line, which must be followed only by other empty lines.
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return grid, err
 		}
 
-		if ch == '\n' {
-			width = chCount
-			height++
-			continue
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) == 0 && blankLine == 0 {
+			blankLine = lineNumber
+		} else if len(line) > 0 {
+			if blankLine > 0 {
+				return grid, fmt.Errorf("line %d: empty line inside the grid", blankLine)
+			}
+
+			row := []rune(line)
+			if grid.height == 0 {
+				grid.width = len(row)
+			} else if len(row) != grid.width {
+				return grid, fmt.Errorf("line %d: expected %d characters, found %d", lineNumber, grid.width, len(row))
+			}
+
+			grid.contents = append(grid.contents, row...)
+			grid.height++
 		}
 
-		grid.contents = append(grid.contents, ch)
-		// Once the grid's width is locked in, we don't need to keep track of the character count.
-		if width == 0 {
-			chCount++
+		if err == io.EOF {
+			break
 		}
 	}
 
-	grid.width = width
-	grid.height = height
-
-	return grid
+	return grid, nil
 }
 
 func main() {
+	word := flag.String("word", "x-mas", "the word to search for: \"xmas\" or \"x-mas\"")
+	render := flag.String("render", "", "draw the matches as \"text\", \"ansi\", \"html\" or \"svg\"")
+	flag.Parse()
+
+	// By changing the FindFunc, I can easily switch between the words I'm searching for.
+	var FindFunc func(int, int, *Grid) []Match
+	switch *word {
+	case "xmas":
+		FindFunc = FindXMAS
+	case "x-mas":
+		FindFunc = FindMAS
+	default:
+		fmt.Fprintf(os.Stderr, "unknown word %q\n", *word)
+		os.Exit(2)
+	}
+
 	file, err := os.Open("./input.txt")
 	if err != nil {
 		panic(err)
@@ -152,9 +238,17 @@ func main() {
 	defer file.Close()
 
 	reader := bufio.NewReader(file)
-	grid := PopulateGridFromReader(reader)
+	grid, err := PopulateGridFromReader(reader)
+	if err != nil {
+		panic(err)
+	}
 
-	count := SearchGrid(&grid)
+	matches := SearchGrid(&grid, FindFunc)
+	if *render != "" {
+		if err := Render(os.Stdout, *render, &grid, matches); err != nil {
+			panic(err)
+		}
+	}
 
-	fmt.Printf("XMAS found: %d\n", count)
+	fmt.Printf("XMAS found: %d\n", len(matches))
 }
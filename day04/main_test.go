@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPopulateGridFromReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		width   int
+		height  int
+		rows    string // Every row joined together, when the input is valid.
+		wantErr string
+	}{
+		{name: "lf", input: "AB\nCD\n", width: 2, height: 2, rows: "ABCD"},
+		{name: "crlf", input: "AB\r\nCD\r\n", width: 2, height: 2, rows: "ABCD"},
+		{name: "no final newline", input: "AB\nCD", width: 2, height: 2, rows: "ABCD"},
+		{name: "trailing empty lines", input: "AB\nCD\n\n\r\n", width: 2, height: 2, rows: "ABCD"},
+		{name: "empty", input: "", width: 0, height: 0, rows: ""},
+		{name: "ragged", input: "AB\nCDE\n", wantErr: "line 2: expected 2 characters, found 3"},
+		{name: "ragged last row", input: "AB\nCD\nEF\nG\n", wantErr: "line 4: expected 2 characters, found 1"},
+		{name: "interior empty line", input: "AB\r\nCD\r\n\r\nEF", wantErr: "line 3: empty line inside the grid"},
+		{name: "several interior empty lines", input: "AB\n\n\nCD\n", wantErr: "line 2: empty line inside the grid"},
+		{name: "leading empty line", input: "\nAB\n", wantErr: "line 1: empty line inside the grid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := PopulateGridFromReader(bufio.NewReader(strings.NewReader(test.input)))
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("expected error %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if grid.width != test.width || grid.height != test.height || string(grid.contents) != test.rows {
+				t.Errorf("got %dx%d grid %q, expected %dx%d grid %q", grid.width, grid.height, string(grid.contents), test.width, test.height, test.rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const hiddenCell = '.'
+
+// One colour per match direction. There are at most 8 directions, for "XMAS".
+var ansiColours = []string{"31", "32", "33", "34", "35", "36", "91", "93"}
+var htmlColours = []string{"#d62728", "#2ca02c", "#bcbd22", "#1f77b4", "#9467bd", "#17becf", "#ff7f0e", "#e377c2"}
+
+/**
+ * Maps each grid index to the direction of a match that covers it, or -1 for cells that aren't part
+ * of any match. Where matches overlap, the later match wins.
+ */
+func MatchDirections(grid *Grid, matches []Match) []int {
+	directions := make([]int, len(grid.contents))
+	for i := range directions {
+		directions[i] = -1
+	}
+
+	for _, match := range matches {
+		for _, cell := range match.cells {
+			directions[grid.ToIndex(cell.x, cell.y)] = match.direction
+		}
+	}
+
+	return directions
+}
+
+/**
+ * Writes the grid with every letter that isn't part of a match replaced by '.', as in the puzzle
+ * statement. When colour is set, matched letters are wrapped in an ANSI colour for their direction.
+ */
+func RenderText(w io.Writer, grid *Grid, matches []Match, colour bool) error {
+	directions := MatchDirections(grid, matches)
+
+	var sb strings.Builder
+	for y := 0; y < grid.height; y++ {
+		for x := 0; x < grid.width; x++ {
+			index := grid.ToIndex(x, y)
+			dir := directions[index]
+			switch {
+			case dir < 0:
+				sb.WriteRune(hiddenCell)
+			case colour:
+				fmt.Fprintf(&sb, "\x1b[%sm%c\x1b[0m", ansiColours[dir%len(ansiColours)], grid.contents[index])
+			default:
+				sb.WriteRune(grid.contents[index])
+			}
+		}
+		sb.WriteRune('\n')
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/**
+ * Writes a standalone HTML page containing the highlighted grid.
+ */
+func RenderHTML(w io.Writer, grid *Grid, matches []Match) error {
+	directions := MatchDirections(grid, matches)
+
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<body style=\"background:#fff\">\n<pre style=\"font-family:monospace\">\n")
+	for y := 0; y < grid.height; y++ {
+		for x := 0; x < grid.width; x++ {
+			index := grid.ToIndex(x, y)
+			dir := directions[index]
+			if dir < 0 {
+				sb.WriteRune(hiddenCell)
+				continue
+			}
+			fmt.Fprintf(&sb, "<span style=\"color:%s;font-weight:bold\">%s</span>",
+				htmlColours[dir%len(htmlColours)], html.EscapeString(string(grid.contents[index])))
+		}
+		sb.WriteRune('\n')
+	}
+	sb.WriteString("</pre>\n</body>\n</html>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/**
+ * Writes an SVG image with one text element per cell. Unmatched cells are drawn faintly so that the
+ * shape of the grid is still visible.
+ */
+func RenderSVG(w io.Writer, grid *Grid, matches []Match) error {
+	const cellSize = 14
+
+	directions := MatchDirections(grid, matches)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"%d\" text-anchor=\"middle\">\n",
+		grid.width*cellSize, grid.height*cellSize, cellSize-2)
+	fmt.Fprintf(&sb, "<rect width=\"100%%\" height=\"100%%\" fill=\"#fff\"/>\n")
+	for y := 0; y < grid.height; y++ {
+		for x := 0; x < grid.width; x++ {
+			index := grid.ToIndex(x, y)
+			dir := directions[index]
+			fill := "#ddd"
+			if dir >= 0 {
+				fill = htmlColours[dir%len(htmlColours)]
+			}
+			fmt.Fprintf(&sb, "<text x=\"%d\" y=\"%d\" fill=\"%s\">%s</text>\n",
+				x*cellSize+cellSize/2, (y+1)*cellSize-2, fill, html.EscapeString(string(grid.contents[index])))
+		}
+	}
+	sb.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/**
+ * Renders the matches in the named format: "text", "ansi", "html" or "svg".
+ */
+func Render(w io.Writer, format string, grid *Grid, matches []Match) error {
+	switch format {
+	case "text":
+		return RenderText(w, grid, matches, false)
+	case "ansi":
+		return RenderText(w, grid, matches, true)
+	case "html":
+		return RenderHTML(w, grid, matches)
+	case "svg":
+		return RenderSVG(w, grid, matches)
+	}
+
+	return fmt.Errorf("unknown render format %q", format)
+}
@@ -1,80 +1,469 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 )
 
-func ValidateUpdate(pages []string, rules *map[string]map[string]bool) bool {
-	updated := make(map[string]bool)
+/**
+ * A directed graph of page-ordering rules. An edge a -> b means that page a must be printed before
+ * page b whenever both appear in the same update.
+ */
+type RuleGraph struct {
+	after map[int]map[int]bool
+}
+
+func NewRuleGraph() *RuleGraph {
+	return &RuleGraph{after: make(map[int]map[int]bool)}
+}
 
+func (graph *RuleGraph) AddRule(before int, after int) {
+	if graph.after[before] == nil {
+		graph.after[before] = make(map[int]bool)
+	}
+	graph.after[before][after] = true
+}
+
+/**
+ * Reports whether a rule requires page a to come before page b.
+ */
+func (graph *RuleGraph) Before(a int, b int) bool {
+	return graph.after[a][b]
+}
+
+/**
+ * Returned when the rules restricted to an update's pages contain a cycle, so no order satisfies them.
+ */
+type CycleError struct {
+	Cycle []int
+}
+
+func (err *CycleError) Error() string {
+	var sb strings.Builder
+	for _, page := range err.Cycle {
+		fmt.Fprintf(&sb, "%d -> ", page)
+	}
+	fmt.Fprintf(&sb, "%d", err.Cycle[0])
+
+	return fmt.Sprintf("rules form a cycle: %s", sb.String())
+}
+
+/**
+ * Returned when the rules don't fully determine the order of an update's pages.
+ */
+type AmbiguousOrderError struct {
+	Candidates []int // The pages that could equally come next in the order.
+}
+
+func (err *AmbiguousOrderError) Error() string {
+	return fmt.Sprintf("order is ambiguous: any of %v could come next", err.Candidates)
+}
+
+/**
+ * Returned when an update contains the same page more than once, so no order of it can satisfy a rule
+ * involving that page.
+ */
+type DuplicatePageError struct {
+	Page int
+}
+
+func (err *DuplicatePageError) Error() string {
+	return fmt.Sprintf("page %d appears more than once", err.Page)
+}
+
+/**
+ * Returns the pages in the unique order permitted by the rules that apply between them. Only the
+ * subgraph induced by the given pages is considered, since the full rule set is allowed to be cyclic.
+ * Each page may appear only once.
+ */
+func (graph *RuleGraph) Sort(pages []int) ([]int, error) {
+	inUpdate := make(map[int]bool, len(pages))
 	for _, page := range pages {
-		updated[page] = true
-		// If a page in the corresponding rules already has an entry in "updates", then it clearly has been updated
-		// before the current page. Thus, the update as a whole is invalid.
-		for rule := range (*rules)[page] {
-			if updated[rule] {
-				return false
+		if inUpdate[page] {
+			return nil, &DuplicatePageError{Page: page}
+		}
+		inUpdate[page] = true
+	}
+
+	// Count the incoming edges of each page within the subgraph.
+	inDegree := make(map[int]int, len(pages))
+	for page := range inUpdate {
+		for next := range graph.after[page] {
+			if inUpdate[next] {
+				inDegree[next]++
 			}
 		}
 	}
 
-	return true
+	ready := make([]int, 0, 1)
+	for page := range inUpdate {
+		if inDegree[page] == 0 {
+			ready = append(ready, page)
+		}
+	}
+
+	sorted := make([]int, 0, len(inUpdate))
+	for len(ready) > 0 {
+		// With more than one page free to go next, the rules don't decide between them.
+		if len(ready) > 1 {
+			slices.Sort(ready)
+			return nil, &AmbiguousOrderError{Candidates: ready}
+		}
+
+		page := ready[0]
+		ready = ready[:0]
+		sorted = append(sorted, page)
+		for next := range graph.after[page] {
+			if !inUpdate[next] {
+				continue
+			}
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if len(sorted) < len(inUpdate) {
+		return nil, &CycleError{Cycle: graph.findCycle(inUpdate, inDegree)}
+	}
+
+	return sorted, nil
 }
 
-func FixUpdate(pages []string, rules *map[string]map[string]bool) []string {
-	CompareFn := func(a string, b string) int {
-		if (*rules)[a][b] {
-			return -1
-		} else if (*rules)[b][a] {
-			return 1
+/**
+ * Finds a cycle among the pages that Sort was unable to place, i.e. those with remaining in-degree.
+ * Every such page has a predecessor that is also unplaced, so walking backwards must repeat a page.
+ */
+func (graph *RuleGraph) findCycle(inUpdate map[int]bool, inDegree map[int]int) []int {
+	// Invert the remaining edges so that we can walk from a page to one of its predecessors.
+	predecessor := make(map[int]int)
+	start := -1
+	for page := range inUpdate {
+		if inDegree[page] == 0 {
+			continue
+		}
+		for next := range graph.after[page] {
+			if inUpdate[next] && inDegree[next] > 0 {
+				predecessor[next] = page
+			}
+		}
+		if start < 0 || page < start {
+			start = page
 		}
-		return 0
 	}
 
-	slices.SortFunc(pages, CompareFn)
+	seen := make(map[int]int)
+	path := make([]int, 0)
+	for page := start; ; page = predecessor[page] {
+		if index, ok := seen[page]; ok {
+			cycle := path[index:]
+			slices.Reverse(cycle)
+			return cycle
+		}
+		seen[page] = len(path)
+		path = append(path, page)
+	}
+}
 
-	return pages
+/**
+ * A rule broken by an update: the page "before" should have been printed before "after", but was
+ * found at a later position.
+ */
+type Violation struct {
+	before    int
+	after     int
+	beforePos int
+	afterPos  int
 }
 
-func main() {
-	bytes, err := os.ReadFile("./input.txt")
+/**
+ * Returns every rule that the update breaks, in the order the offending pages appear. An empty
+ * result means that the update is valid.
+ */
+func ValidateUpdate(pages []int, rules *RuleGraph) []Violation {
+	violations := make([]Violation, 0)
+
+	for i, page := range pages {
+		// If a page that this page must precede has already been updated, the rule has been broken.
+		for j, earlier := range pages[:i] {
+			if rules.Before(page, earlier) {
+				violations = append(violations, Violation{before: page, after: earlier, beforePos: i, afterPos: j})
+			}
+		}
+	}
+
+	return violations
+}
+
+/**
+ * Moving a page takes it out of the update at index "from" and reinserts it so that it ends up at
+ * index "to". Moves are applied one after another.
+ */
+type Move struct {
+	page int
+	from int
+	to   int
+}
+
+/**
+ * Returns the indices of a longest strictly increasing subsequence of the values.
+ */
+func LongestIncreasing(values []int) []int {
+	tails := make([]int, 0, len(values)) // tails[k] is the index ending the best subsequence of length k+1.
+	parent := make([]int, len(values))   // The previous index in the subsequence ending at each index.
+	for i, value := range values {
+		k, _ := slices.BinarySearchFunc(tails, value, func(index int, target int) int {
+			return values[index] - target
+		})
+		parent[i] = -1
+		if k > 0 {
+			parent[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	sequence := make([]int, len(tails))
+	if len(tails) == 0 {
+		return sequence
+	}
+	for k, i := len(tails)-1, tails[len(tails)-1]; k >= 0; k, i = k-1, parent[i] {
+		sequence[k] = i
+	}
+
+	return sequence
+}
+
+/**
+ * Reorders the pages in place so that they satisfy the rules, and returns the moves that did so.
+ * Pages that already form the longest run in the correct relative order are left alone, which
+ * makes the number of moves the smallest possible.
+ */
+func FixUpdate(pages []int, rules *RuleGraph) ([]int, []Move, error) {
+	sorted, err := rules.Sort(pages)
 	if err != nil {
-		panic(err)
+		return pages, nil, err
 	}
-	contents := string(bytes)
 
-	matchRules, _ := regexp.Compile(`(\d{2})\|(\d{2})`)
-	ruleStrings := matchRules.FindAllStringSubmatch(contents, -1)
+	rank := make(map[int]int, len(sorted))
+	for i, page := range sorted {
+		rank[page] = i
+	}
+	ranks := make([]int, len(pages))
+	for i, page := range pages {
+		ranks[i] = rank[page]
+	}
 
-	rules := make(map[string]map[string]bool)
-	for _, match := range ruleStrings {
-		before := match[1]
-		after := match[2]
-		if rules[before] == nil {
-			rules[before] = make(map[string]bool)
+	settled := make(map[int]bool, len(pages))
+	for _, i := range LongestIncreasing(ranks) {
+		settled[pages[i]] = true
+	}
+
+	// Place the unsettled pages in order of their final position, each directly after the last settled
+	// page that precedes it. The settled pages therefore always stay in the correct relative order.
+	moves := make([]Move, 0, len(pages)-len(settled))
+	for _, page := range sorted {
+		if settled[page] {
+			continue
+		}
+
+		from := slices.Index(pages, page)
+		pages = slices.Delete(pages, from, from+1)
+		to := 0
+		for i, other := range pages {
+			if settled[other] && rank[other] < rank[page] {
+				to = i + 1
+			}
+		}
+		pages = slices.Insert(pages, to, page)
+
+		settled[page] = true
+		moves = append(moves, Move{page: page, from: from, to: to})
+	}
+
+	return pages, moves, nil
+}
+
+type Rule struct {
+	before int
+	after  int
+}
+
+func ParsePage(field string) (int, error) {
+	page, err := strconv.Atoi(strings.TrimSpace(field))
+	if err != nil {
+		return 0, fmt.Errorf("invalid page number %q", field)
+	}
+	if page < 0 {
+		return 0, fmt.Errorf("page number %d can't be negative", page)
+	}
+
+	return page, nil
+}
+
+/**
+ * Parses the puzzle input: a section of "X|Y" ordering rules, a blank line, then a section of
+ * comma-separated updates. Every line is validated, including that no update repeats a page, and
+ * errors report the offending line number.
+ */
+func ParseInput(r *bufio.Reader) ([]Rule, [][]int, error) {
+	rules := make([]Rule, 0, 1024)
+	updates := make([][]int, 0, 256)
+
+	inUpdates := false
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := r.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, nil, readErr
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			// The first blank line separates the rules from the updates. Any after that are ignored.
+			inUpdates = true
+		case !inUpdates:
+			before, after, found := strings.Cut(line, "|")
+			if !found {
+				return nil, nil, fmt.Errorf("line %d: expected a rule of the form X|Y, found %q", lineNum, line)
+			}
+			beforePage, err := ParsePage(before)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			afterPage, err := ParsePage(after)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			rules = append(rules, Rule{beforePage, afterPage})
+		default:
+			fields := strings.Split(line, ",")
+			pages := make([]int, len(fields))
+			seen := make(map[int]bool, len(fields))
+			for i, field := range fields {
+				page, err := ParsePage(field)
+				if err != nil {
+					return nil, nil, fmt.Errorf("line %d: %w", lineNum, err)
+				}
+				if seen[page] {
+					return nil, nil, fmt.Errorf("line %d: %w", lineNum, &DuplicatePageError{Page: page})
+				}
+				seen[page] = true
+				pages[i] = page
+			}
+			updates = append(updates, pages)
+		}
+
+		if readErr == io.EOF {
+			break
 		}
-		rules[before][after] = true
 	}
 
-	matchUpdates, _ := regexp.Compile(`((?:,?\d{2}){2,})`)
-	updateStrings := matchUpdates.FindAllString(contents, -1)
+	return rules, updates, nil
+}
+
+/**
+ * Returns the page in the middle of an update. Only odd-length updates have a middle page.
+ */
+func MiddlePage(pages []int) (int, error) {
+	if len(pages)%2 == 0 {
+		return 0, fmt.Errorf("update %v has an even number of pages, so has no middle page", pages)
+	}
+
+	return pages[len(pages)/2], nil
+}
+
+func JoinPages(pages []int) string {
+	fields := make([]string, len(pages))
+	for i, page := range pages {
+		fields[i] = strconv.Itoa(page)
+	}
+
+	return strings.Join(fields, ",")
+}
+
+/**
+ * Validates every update in one pass, summing the middle pages of the updates that were already
+ * valid (part 1) and of the updates once they have been fixed (part 2). Updates are fixed in place.
+ * When report is non-nil, the violations, moves and corrected order of each invalid update are
+ * written to it.
+ */
+func SumMiddlePages(updates [][]int, rules *RuleGraph, report io.Writer) (int, int, error) {
+	validTotal := 0
+	fixedTotal := 0
+	for updateNum, pages := range updates {
+		violations := ValidateUpdate(pages, rules)
+		if len(violations) == 0 {
+			middle, err := MiddlePage(pages)
+			if err != nil {
+				return 0, 0, fmt.Errorf("update %d: %w", updateNum+1, err)
+			}
+			validTotal += middle
+			continue
+		}
 
-	middleTotal := 0
-	for _, PagesStr := range updateStrings {
-		pages := strings.Split(PagesStr, ",")
-		if !ValidateUpdate(pages, &rules) {
-			FixUpdate(pages, &rules)
-			fmt.Printf("Fixed: %t - %v\n", ValidateUpdate(pages, &rules), pages)
+		if report != nil {
+			fmt.Fprintf(report, "Update %d: %s\n", updateNum+1, JoinPages(pages))
+			for _, v := range violations {
+				fmt.Fprintf(report, "  violates %d|%d: %d at position %d, %d at position %d\n",
+					v.before, v.after, v.before, v.beforePos, v.after, v.afterPos)
+			}
+		}
+
+		fixed, moves, err := FixUpdate(pages, rules)
+		if err != nil {
+			return 0, 0, fmt.Errorf("update %d: %w", updateNum+1, err)
+		}
+		updates[updateNum] = fixed
 
-			middleValue, _ := strconv.Atoi(pages[len(pages)/2])
-			middleTotal += middleValue
+		if report != nil {
+			for _, move := range moves {
+				fmt.Fprintf(report, "  move %d from position %d to %d\n", move.page, move.from, move.to)
+			}
+			fmt.Fprintf(report, "  corrected: %s\n", JoinPages(fixed))
+		}
+
+		middle, err := MiddlePage(fixed)
+		if err != nil {
+			return 0, 0, fmt.Errorf("update %d: %w", updateNum+1, err)
 		}
+		fixedTotal += middle
+	}
+
+	return validTotal, fixedTotal, nil
+}
+
+func main() {
+	file, err := os.Open("./input.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	ruleList, updates, err := ParseInput(bufio.NewReader(file))
+	if err != nil {
+		panic(err)
+	}
+
+	rules := NewRuleGraph()
+	for _, rule := range ruleList {
+		rules.AddRule(rule.before, rule.after)
+	}
+
+	validTotal, fixedTotal, err := SumMiddlePages(updates, rules, os.Stdout)
+	if err != nil {
+		panic(err)
 	}
 
-	fmt.Printf("Middle value total: %d\n", middleTotal)
+	fmt.Printf("Middle value total (valid updates): %d\n", validTotal)
+	fmt.Printf("Middle value total (fixed updates): %d\n", fixedTotal)
 }
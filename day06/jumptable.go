@@ -0,0 +1,194 @@
+package main
+
+/**
+ * The four headings, in clockwise order so that a 90 degree CW turn is (dir + 1) % 4.
+ */
+const (
+	UP    = 0
+	RIGHT = 1
+	DOWN  = 2
+	LEFT  = 3
+)
+
+var headings = [4]Vec{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+var guardGlyphs = [4]rune{'^', '>', 'v', '<'}
+
+func HeadingIndex(dir Vec) int {
+	for i, heading := range headings {
+		if heading.Equal(dir) {
+			return i
+		}
+	}
+
+	panic("The guard can only face along the grid axes.")
+}
+
+/**
+ * A dense set of non-negative integers.
+ */
+type Bitset []uint64
+
+func NewBitset(size int) Bitset {
+	return make(Bitset, (size+63)/64)
+}
+
+func (set Bitset) Set(i int) {
+	set[i/64] |= 1 << (i % 64)
+}
+
+func (set Bitset) Clear(i int) {
+	set[i/64] &^= 1 << (i % 64)
+}
+
+func (set Bitset) Test(i int) bool {
+	return set[i/64]&(1<<(i%64)) != 0
+}
+
+/**
+ * For every cell and heading, records the cell at which a guard walking from that cell stops because
+ * the next cell holds an obstruction. Guards that would walk off the grid instead stop at -1.
+ */
+type JumpTable struct {
+	grid *Grid
+	next [4][]int
+}
+
+func NewJumpTable(grid *Grid) *JumpTable {
+	table := JumpTable{grid: grid}
+
+	for dir, heading := range headings {
+		next := make([]int, len(grid.contents))
+		table.next[dir] = next
+
+		// Fill the cells nearest the edge being walked towards first, so that each cell can reuse
+		// the answer of the cell in front of it.
+		xs, ys := axisOrder(grid.width, heading.x), axisOrder(grid.height, heading.y)
+		for _, y := range ys {
+			for _, x := range xs {
+				pos := Vec{x, y}
+				ahead := pos.Add(heading)
+				switch {
+				case !grid.InBounds(ahead):
+					next[grid.ToIndex(pos)] = -1
+				case grid.contents[grid.ToIndex(ahead)] == '#':
+					next[grid.ToIndex(pos)] = grid.ToIndex(pos)
+				default:
+					next[grid.ToIndex(pos)] = next[grid.ToIndex(ahead)]
+				}
+			}
+		}
+	}
+
+	return &table
+}
+
+/**
+ * Returns the coordinates along one axis, ordered so that those furthest along the step come first.
+ */
+func axisOrder(length int, step int) []int {
+	order := make([]int, length)
+	for i := range order {
+		if step > 0 {
+			order[i] = length - 1 - i
+		} else {
+			order[i] = i
+		}
+	}
+
+	return order
+}
+
+/**
+ * Returns the index of the cell at which a guard leaving the given cell with the given heading stops,
+ * or -1 if the guard walks off the grid. The extra obstruction, given as a cell index (or -1 for none),
+ * is accounted for without modifying the table: it only matters when it lies between the guard and
+ * wherever the guard would have stopped without it.
+ */
+func (table *JumpTable) Jump(from int, dir int, obstruction int) int {
+	stop := table.next[dir][from]
+	if obstruction < 0 {
+		return stop
+	}
+
+	grid := table.grid
+	heading := headings[dir]
+	start := Vec{from % grid.width, from / grid.width}
+	target := Vec{obstruction % grid.width, obstruction / grid.width}
+
+	// The obstruction has to lie on the guard's line of travel, strictly in front of the guard.
+	offset := Vec{target.x - start.x, target.y - start.y}
+	if offset.x*heading.y != offset.y*heading.x {
+		return stop
+	}
+	distance := offset.x*heading.x + offset.y*heading.y
+	if distance < 1 {
+		return stop
+	}
+
+	if stop >= 0 {
+		end := Vec{stop % grid.width, stop / grid.width}
+		if distance > (end.x-start.x)*heading.x+(end.y-start.y)*heading.y {
+			return stop
+		}
+	}
+
+	return grid.ToIndex(Vec{target.x - heading.x, target.y - heading.y})
+}
+
+/**
+ * Detects loops by jumping the guard from one turn to the next. The set of (cell, heading) states at
+ * which the guard has turned is kept between runs and only the entries that were set are cleared.
+ */
+type LoopDetector struct {
+	table   *JumpTable
+	turns   Bitset
+	touched []int
+}
+
+func NewLoopDetector(table *JumpTable) *LoopDetector {
+	return &LoopDetector{
+		table:   table,
+		turns:   NewBitset(len(table.grid.contents) * len(headings)),
+		touched: make([]int, 0, 256),
+	}
+}
+
+/**
+ * Reports whether the guard becomes stuck in a loop once an obstruction is placed at the given
+ * position. A loop is found when the guard turns at the same cell, with the same heading, twice.
+ */
+func (detector *LoopDetector) Loops(guard Guard, newObstruction Vec) bool {
+	grid := detector.table.grid
+	if !grid.InBounds(newObstruction) {
+		return false
+	}
+
+	obstruction := grid.ToIndex(newObstruction)
+	pos := grid.ToIndex(guard.pos)
+	dir := HeadingIndex(guard.dir)
+
+	looping := false
+	for {
+		pos = detector.table.Jump(pos, dir, obstruction)
+		if pos < 0 {
+			break
+		}
+
+		state := pos*len(headings) + dir
+		if detector.turns.Test(state) {
+			looping = true
+			break
+		}
+		detector.turns.Set(state)
+		detector.touched = append(detector.touched, state)
+
+		dir = (dir + 1) % len(headings)
+	}
+
+	for _, state := range detector.touched {
+		detector.turns.Clear(state)
+	}
+	detector.touched = detector.touched[:0]
+
+	return looping
+}
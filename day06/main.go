@@ -2,10 +2,14 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"slices"
+	"sync"
+	"time"
 )
 
 type Grid struct {
@@ -48,84 +52,205 @@ func (vector Vec) Equal(other Vec) bool {
 	return vector.x == other.x && vector.y == other.y
 }
 
+/**
+ * Anything the guard can patrol: the grid itself, or the grid with an extra obstruction laid over it.
+ */
+type Terrain interface {
+	InBounds(pos Vec) bool
+	Blocked(pos Vec) bool
+	Wrap(pos Vec) Vec
+}
+
+func (grid *Grid) Blocked(pos Vec) bool {
+	return grid.contents[grid.ToIndex(pos)] == '#'
+}
+
+/**
+ * Brings a position that has left the grid back in on the opposite side.
+ */
+func (grid *Grid) Wrap(pos Vec) Vec {
+	return Vec{(pos.x%grid.width + grid.width) % grid.width, (pos.y%grid.height + grid.height) % grid.height}
+}
+
+/**
+ * A grid with one extra obstruction. The grid itself is never modified, so any number of overlays
+ * may share it concurrently.
+ */
+type Overlay struct {
+	*Grid
+	obstruction Vec
+}
+
+func (overlay *Overlay) Blocked(pos Vec) bool {
+	return pos.Equal(overlay.obstruction) || overlay.Grid.Blocked(pos)
+}
+
 /**
  * Functions for the problem.
  */
 
-func AvoidObstruction(guard *Guard, grid *Grid) bool {
-	stepAhead := guard.pos.Add(guard.dir)
-	if !grid.InBounds(stepAhead) {
+func AvoidObstruction(guard *Guard, terrain Terrain, rules *Rules) bool {
+	stepAhead := rules.Ahead(guard, terrain)
+	if !terrain.InBounds(stepAhead) {
 		return false
 	}
 
-	if grid.contents[grid.ToIndex(stepAhead)] == '#' {
-		// Rotate the guard 90 degrees CW if an obstruction is directly ahead.
-		guard.dir = Vec{-guard.dir.y, guard.dir.x}
+	if terrain.Blocked(stepAhead) {
+		// Rotate the guard if an obstruction is directly ahead. The puzzle's guard turns 90 degrees CW.
+		guard.dir = rules.Turn(guard.dir)
 		return true
 	}
 
 	return false
 }
 
-func Step(guard *Guard, grid *Grid) bool {
-	for AvoidObstruction(guard, grid) {
+/**
+ * Turns the guard until the path ahead is clear, which may take two turns in a dead end. Returns
+ * false if the guard is boxed in on all sides, in which case it ends up facing the way it started.
+ */
+func TurnToClear(guard *Guard, terrain Terrain, rules *Rules) bool {
+	for range rules.TurnsPerRevolution() {
+		if !AvoidObstruction(guard, terrain, rules) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+ * Moves the guard one tile, turning first if needed. A guard that is boxed in stays where it is.
+ * Returns false once the guard has left the grid.
+ */
+func Step(guard *Guard, terrain Terrain, rules *Rules) bool {
+	if TurnToClear(guard, terrain, rules) {
+		guard.pos = rules.Ahead(guard, terrain)
 	}
 
-	guard.pos = guard.pos.Add(guard.dir)
-	return grid.InBounds(guard.pos)
+	return terrain.InBounds(guard.pos)
 }
 
-func TestLoop(newObstruction Vec, guard *Guard, grid *Grid) bool {
+func TestLoop(newObstruction Vec, guard *Guard, grid *Grid, rules *Rules) bool {
 	if !grid.InBounds(newObstruction) {
 		return false
 	}
 
-	virtualGuard := *guard           // The simulated guard
-	pathHistory := make(map[Vec]Vec) // Records the position the guard was last facing at each position.
-
-	obstructionIndex := grid.ToIndex(newObstruction)
-	looping := false
-	// Place the obstruction for the similation.
-	grid.contents[obstructionIndex] = '#'
-	for Step(&virtualGuard, grid) {
-		if pathHistory[virtualGuard.pos].Equal(virtualGuard.dir) {
-			// Loops are achieved when the guard reaches any given point and faces the same direction as the
-			// last time it was at that point.
-			looping = true
-			break
+	virtualGuard := *guard              // The simulated guard
+	pathHistory := make(map[Guard]bool) // Records every (position, direction) state the guard has been in.
+	pathHistory[virtualGuard] = true
+
+	// Lay the obstruction over the grid for the simulation.
+	overlay := Overlay{Grid: grid, obstruction: newObstruction}
+	for Step(&virtualGuard, &overlay, rules) {
+		if pathHistory[virtualGuard] {
+			// Loops are achieved when the guard reaches any given point facing the same direction as any
+			// previous time it was at that point. A single tile may be crossed in several directions.
+			return true
 		}
-		pathHistory[virtualGuard.pos] = virtualGuard.dir
+		pathHistory[virtualGuard] = true
 	}
 
-	// Remove the obstruction now that the simulation is over
-	grid.contents[obstructionIndex] = '.'
+	return false
+}
 
-	return looping
+/**
+ * A position at which an obstruction could be placed, along with the state of the guard just before
+ * it would have walked into it.
+ */
+type Candidate struct {
+	guard       Guard
+	obstruction Vec
 }
 
-func WalkPatrol(guard *Guard, grid *Grid) (int, int) {
-	coveredTiles := make(map[Vec]bool) // A set of all tiles that the guard has visited.
+/**
+ * Walks the guard off the grid, returning the number of distinct tiles covered and every position at
+ * which an obstruction could be placed. Obstructions are only considered on tiles the guard hasn't
+ * already patrolled. They might notice! Under rules where the guard never leaves, the walk ends once
+ * the guard repeats a state.
+ */
+func WalkPatrol(guard *Guard, grid *Grid, rules *Rules) ([]Candidate, int) {
+	coveredTiles := NewBitset(len(grid.contents))                 // The set of all tiles that the guard has visited.
+	visitedStates := NewBitset(len(grid.contents) * len(compass)) // The set of all states the guard has been in.
+	candidates := make([]Candidate, 0, 1024)
 
-	loopsFormed := 0
+	tilesCovered := 0
 	for grid.InBounds(guard.pos) {
-		coveredTiles[guard.pos] = true
-		// Turn untill the path ahead of the guard is empty.
-		for AvoidObstruction(guard, grid) {
+		if !coveredTiles.Test(grid.ToIndex(guard.pos)) {
+			coveredTiles.Set(grid.ToIndex(guard.pos))
+			tilesCovered++
+		}
+		// Turn untill the path ahead of the guard is empty. A boxed-in guard has nowhere left to patrol.
+		if !TurnToClear(guard, grid, rules) {
+			break
 		}
 
-		nextPosition := guard.dir.Add(guard.pos)
-		// Place an obstruction in front of the guard and simulate the new path
-		// to determine if a loop forms.
-		// We don't do this for tiles that the guard has already patroled though. They might notice!
-		if !coveredTiles[nextPosition] && TestLoop(nextPosition, guard, grid) {
-			loopsFormed++
+		state := StateIndex(guard, grid)
+		if visitedStates.Test(state) {
+			break
+		}
+		visitedStates.Set(state)
+
+		nextPosition := rules.Ahead(guard, grid)
+		if grid.InBounds(nextPosition) && !coveredTiles.Test(grid.ToIndex(nextPosition)) {
+			// Mark the tile now so that it's only offered once, for the first time the guard reaches it.
+			coveredTiles.Set(grid.ToIndex(nextPosition))
+			tilesCovered++
+			candidates = append(candidates, Candidate{guard: *guard, obstruction: nextPosition})
 		}
 
 		// Move the guard to the next position.
 		guard.pos = nextPosition
 	}
 
-	return loopsFormed, len(coveredTiles)
+	return candidates, tilesCovered
+}
+
+/**
+ * Determines which candidate obstructions trap the guard in a loop. The candidates are shared out
+ * between a pool of workers, each with its own loop detector over the shared, read-only jump table.
+ * Results are stored by candidate index, so they don't depend on the order in which workers finish.
+ * The jump table only models the puzzle's rules, so any other rules fall back to the step-by-step
+ * simulation in TestLoop. When verify is set, the jump table's answers are checked against TestLoop
+ * and the candidates on which they disagree are returned, in candidate order.
+ */
+func FindLoops(candidates []Candidate, grid *Grid, rules *Rules, workers int, verify bool) ([]bool, []Candidate) {
+	table := NewJumpTable(grid)
+	loops := make([]bool, len(candidates))
+	disagrees := make([]bool, len(candidates))
+
+	jobs := make(chan int, max(workers, 1))
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			detector := NewLoopDetector(table)
+			for i := range jobs {
+				candidate := candidates[i]
+				if !rules.IsPuzzle() {
+					loops[i] = TestLoop(candidate.obstruction, &candidate.guard, grid, rules)
+					continue
+				}
+				loops[i] = detector.Loops(candidate.guard, candidate.obstruction)
+				disagrees[i] = verify && loops[i] != TestLoop(candidate.obstruction, &candidate.guard, grid, rules)
+			}
+		}()
+	}
+
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	disagreements := make([]Candidate, 0)
+	for i, disagree := range disagrees {
+		if disagree {
+			disagreements = append(disagreements, candidates[i])
+		}
+	}
+
+	return loops, disagreements
 }
 
 func PopulateGridFromReader(r *bufio.Reader) Grid {
@@ -163,7 +288,84 @@ func PopulateGridFromReader(r *bufio.Reader) Grid {
 	return grid
 }
 
+/**
+ * Finds every guard on the grid by its heading ('^', '>', 'v' or '<') and replaces it with open floor.
+ * Returns an error for any other character that isn't '.' or '#', or if there are no guards at all.
+ */
+func ParseGuards(grid *Grid) ([]Guard, error) {
+	guards := make([]Guard, 0, 1)
+	for i, c := range grid.contents {
+		pos := Vec{i % grid.width, i / grid.width}
+		switch c {
+		case '.', '#':
+			continue
+		case '^', '>', 'v', '<':
+			dir := slices.Index(guardGlyphs[:], c)
+			guards = append(guards, Guard{pos: pos, dir: headings[dir]})
+			grid.contents[i] = '.'
+		default:
+			return nil, fmt.Errorf("unknown character %q at (%d, %d)", c, pos.x, pos.y)
+		}
+	}
+
+	if len(guards) == 0 {
+		return nil, fmt.Errorf("no guard found on the map")
+	}
+
+	return guards, nil
+}
+
+func Render(format string, out string, grid *Grid, rules *Rules, starts []Guard, obstructions []Vec, every int, scale int, delay time.Duration) error {
+	patrols := make([][]Guard, len(starts))
+	for i, start := range starts {
+		patrols[i] = TracePatrol(start, grid, rules)
+	}
+
+	switch format {
+	case "text":
+		return RenderPatrol(os.Stdout, grid, patrols, obstructions)
+	case "animate":
+		return AnimatePatrol(os.Stdout, grid, patrols, every, delay)
+	case "gif":
+		file, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return WritePatrolGIF(file, grid, patrols, obstructions, every, scale, delay)
+	case "png":
+		return WritePatrolPNGs(out, grid, patrols, obstructions, every, scale)
+	}
+
+	return fmt.Errorf("unknown render format %q", format)
+}
+
 func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of goroutines used to test obstructions")
+	verify := flag.Bool("verify", false, "cross-check loop detection against the step-by-step simulation")
+	render := flag.String("render", "", "draw the patrol: \"text\", \"animate\", \"gif\" or \"png\"")
+	out := flag.String("out", "patrol", "output file (gif) or directory (png) when rendering")
+	every := flag.Int("every", 1, "number of steps between animation frames")
+	scale := flag.Int("scale", 4, "pixels per tile in gif and png output")
+	delay := flag.Duration("delay", 50*time.Millisecond, "time between animation frames")
+	counterClockwise := flag.Bool("ccw", false, "turn the guard counter-clockwise instead of clockwise")
+	angle := flag.Int("angle", 90, "degrees the guard turns by when blocked: 90, or 45 to allow diagonal moves")
+	wrap := flag.Bool("wrap", false, "wrap the guard around the edges of the map instead of letting it leave")
+	flag.Parse()
+
+	rules, err := NewRules(!*counterClockwise, *angle, *wrap)
+	if err != nil {
+		panic(err)
+	}
+	if *scale < 1 {
+		fmt.Fprintf(os.Stderr, "-scale must be at least 1 pixel per tile, not %d\n", *scale)
+		os.Exit(2)
+	}
+	if *every < 1 {
+		fmt.Fprintf(os.Stderr, "-every must be at least 1 step, using 1 instead of %d\n", *every)
+		*every = 1
+	}
+
 	file, err := os.Open("./input.txt")
 	if err != nil {
 		panic(err)
@@ -173,27 +375,47 @@ func main() {
 	reader := bufio.NewReader(file)
 	grid := PopulateGridFromReader(reader)
 
-	var nonGuardTiles = []rune{'.', '#', '\n'}
-	var guard Guard
-	// Search for the guard to find the initial direction.
-	for i, c := range grid.contents {
-		if !slices.Contains(nonGuardTiles, c) {
-			guard.pos = Vec{i % grid.width, i / grid.width}
-			switch c {
-			case '^':
-				guard.dir = Vec{0, -1}
-			case '>':
-				guard.dir = Vec{1, 0}
-			case 'V':
-				guard.dir = Vec{0, 1}
-			case '<':
-				guard.dir = Vec{-1, 0}
+	starts, err := ParseGuards(&grid)
+	if err != nil {
+		panic(err)
+	}
+
+	// Each guard patrols the map independently; guards don't block one another.
+	obstructions := make([]Vec, 0)
+	for i, start := range starts {
+		guard := start
+		candidates, tilesCovered := WalkPatrol(&guard, &grid, &rules)
+		loopsFound := 0
+		// With wrapping edges every patrol ends in a loop, whatever is placed in the guard's way.
+		if rules.CanLeave() {
+			loops, disagreements := FindLoops(candidates, &grid, &rules, *workers, *verify)
+			for _, candidate := range disagreements {
+				fmt.Printf("Loop detection disagrees for an obstruction at %v\n", candidate.obstruction)
+			}
+			for j, looping := range loops {
+				if looping {
+					loopsFound++
+					if !slices.Contains(obstructions, candidates[j].obstruction) {
+						obstructions = append(obstructions, candidates[j].obstruction)
+					}
+				}
 			}
 		}
-	}
 
-	loopsFound, tilesCovered := WalkPatrol(&guard, &grid)
+		if len(starts) > 1 {
+			fmt.Printf("Guard %d at (%d, %d) facing %c\n", i+1, start.pos.x, start.pos.y, GuardGlyph(start.dir))
+		}
+		fmt.Printf("Tiles covered: %d\n", tilesCovered)
+		if rules.CanLeave() {
+			fmt.Printf("  Loops found: %d\n", loopsFound)
+		} else {
+			fmt.Println("  Loops found: n/a, the guard can't leave a map with wrapping edges")
+		}
+	}
 
-	fmt.Printf("Tiles covered: %d\n", tilesCovered)
-	fmt.Printf("  Loops found: %d\n", loopsFound)
+	if *render != "" {
+		if err := Render(*render, *out, &grid, &rules, starts, obstructions, *every, *scale, *delay); err != nil {
+			panic(err)
+		}
+	}
 }
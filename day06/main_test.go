@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var exampleMap = []string{
+	"....#.....",
+	".........#",
+	"..........",
+	"..#.......",
+	".......#..",
+	"..........",
+	".#..^.....",
+	"........#.",
+	"#.........",
+	"......#...",
+}
+
+/**
+ * Builds a grid from its rows, returning it along with the single guard drawn on it.
+ */
+func parseMap(t *testing.T, rows []string) (Grid, Guard) {
+	t.Helper()
+
+	grid := PopulateGridFromReader(bufio.NewReader(strings.NewReader(strings.Join(rows, "\n") + "\n")))
+	guards, err := ParseGuards(&grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(guards) != 1 {
+		t.Fatalf("expected one guard, found %d", len(guards))
+	}
+
+	return grid, guards[0]
+}
+
+func TestFindLoopsWorkers(t *testing.T) {
+	grid, start := parseMap(t, exampleMap)
+	guard := start
+	candidates, tilesCovered := WalkPatrol(&guard, &grid, &PuzzleRules)
+	if tilesCovered != 41 {
+		t.Errorf("expected 41 tiles covered, found %d", tilesCovered)
+	}
+
+	expected, disagreements := FindLoops(candidates, &grid, &PuzzleRules, 1, true)
+	if len(disagreements) > 0 {
+		t.Errorf("one worker: the loop detector and TestLoop disagree on %v", disagreements)
+	}
+	loops := 0
+	for _, looping := range expected {
+		if looping {
+			loops++
+		}
+	}
+	if loops != 6 {
+		t.Errorf("expected 6 loops with one worker, found %d", loops)
+	}
+
+	for _, workers := range []int{-1, 0, 2, 4, 16} {
+		actual, disagreements := FindLoops(candidates, &grid, &PuzzleRules, workers, true)
+		if !slices.Equal(actual, expected) {
+			t.Errorf("%d workers: found loops %v, expected %v", workers, actual, expected)
+		}
+		if len(disagreements) > 0 {
+			t.Errorf("%d workers: the loop detector and TestLoop disagree on %v", workers, disagreements)
+		}
+	}
+}
+
+/**
+ * Checks TestLoop against the jump table's loop detector for an obstruction on every free tile of
+ * the map, and returns the number of tiles at which the guard ends up in a loop.
+ */
+func compareLoopDetection(t *testing.T, rows []string) int {
+	t.Helper()
+
+	grid, guard := parseMap(t, rows)
+	detector := NewLoopDetector(NewJumpTable(&grid))
+
+	loops := 0
+	for y := range grid.height {
+		for x := range grid.width {
+			obstruction := Vec{x, y}
+			if grid.Blocked(obstruction) || obstruction.Equal(guard.pos) {
+				continue
+			}
+
+			simulated := TestLoop(obstruction, &guard, &grid, &PuzzleRules)
+			if jumped := detector.Loops(guard, obstruction); simulated != jumped {
+				t.Errorf("obstruction at %v: TestLoop reports %t, the loop detector %t", obstruction, simulated, jumped)
+			}
+			if simulated {
+				loops++
+			}
+		}
+	}
+
+	return loops
+}
+
+func TestLoopDetection(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []string
+		loops int
+	}{
+		{"example", exampleMap, 6},
+		// The guard's path crosses itself at (2, 3) on its way off the map. Crossing a tile in a new
+		// direction isn't a loop.
+		{"crossing", []string{
+			"..#.....",
+			".......#",
+			"........",
+			"#.......",
+			"......#.",
+			"..^.....",
+		}, 2},
+		// The guard is blocked ahead and to the right, so turns twice and walks back the way it came.
+		{"u-turn", []string{
+			".....",
+			"..#..",
+			".#^#.",
+			".....",
+		}, 1},
+		// The guard can't move at all, and stays put whatever is placed around it.
+		{"boxed in", []string{
+			".#.",
+			"#^#",
+			".#.",
+		}, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if loops := compareLoopDetection(t, test.rows); loops != test.loops {
+				t.Errorf("expected %d obstructions to cause a loop, found %d", test.loops, loops)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The axes along which the guard has walked through a tile.
+const (
+	VERTICAL   uint8 = 1
+	HORIZONTAL uint8 = 2
+	RISING     uint8 = 4 // Diagonally, from bottom-left to top-right.
+	FALLING    uint8 = 8 // Diagonally, from top-left to bottom-right.
+)
+
+/**
+ * Guards facing along the grid axes are drawn by their heading. Diagonal headings are drawn as '*'.
+ */
+func GuardGlyph(dir Vec) rune {
+	if dir.x != 0 && dir.y != 0 {
+		return '*'
+	}
+
+	return guardGlyphs[HeadingIndex(dir)]
+}
+
+/**
+ * Records the guard's state after every step until it leaves the terrain or repeats a state. The
+ * first entry is the starting state.
+ */
+func TracePatrol(guard Guard, terrain Terrain, rules *Rules) []Guard {
+	states := []Guard{guard}
+	seen := map[Guard]bool{guard: true}
+	for Step(&guard, terrain, rules) && !seen[guard] {
+		seen[guard] = true
+		states = append(states, guard)
+	}
+
+	return states
+}
+
+/**
+ * Accumulates the axes along which each tile has been crossed, one step of the patrol at a time.
+ */
+type PathMarks struct {
+	grid  *Grid
+	marks []uint8
+}
+
+func NewPathMarks(grid *Grid) *PathMarks {
+	return &PathMarks{grid: grid, marks: make([]uint8, len(grid.contents))}
+}
+
+/**
+ * Marks the step between two consecutive states. The tile being left is marked along the heading of
+ * the step too, so that the tiles at which the guard turns end up crossed both ways.
+ */
+func (path *PathMarks) Add(from Guard, to Guard) {
+	var axis uint8
+	switch {
+	case to.dir.x == 0:
+		axis = VERTICAL
+	case to.dir.y == 0:
+		axis = HORIZONTAL
+	case to.dir.x == to.dir.y:
+		axis = FALLING
+	default:
+		axis = RISING
+	}
+
+	for _, pos := range []Vec{from.pos, to.pos} {
+		if path.grid.InBounds(pos) && !from.pos.Equal(to.pos) {
+			path.marks[path.grid.ToIndex(pos)] |= axis
+		}
+	}
+}
+
+/**
+ * Returns the tiles of the grid as the puzzle draws them: '|', '-' and '+' for the guards' paths,
+ * 'O' for the given obstructions and each of the given guards by its heading.
+ */
+func (path *PathMarks) Tiles(guards []Guard, obstructions []Vec) []rune {
+	grid := path.grid
+	tiles := make([]rune, len(grid.contents))
+	for i, mark := range path.marks {
+		switch {
+		case grid.contents[i] == '#':
+			tiles[i] = '#'
+		case mark == 0:
+			tiles[i] = '.'
+		case mark == VERTICAL:
+			tiles[i] = '|'
+		case mark == HORIZONTAL:
+			tiles[i] = '-'
+		case mark == RISING:
+			tiles[i] = '/'
+		case mark == FALLING:
+			tiles[i] = '\\'
+		default:
+			// Crossed along more than one axis.
+			tiles[i] = '+'
+		}
+	}
+
+	for _, obstruction := range obstructions {
+		tiles[grid.ToIndex(obstruction)] = 'O'
+	}
+	for _, guard := range guards {
+		if grid.InBounds(guard.pos) {
+			tiles[grid.ToIndex(guard.pos)] = GuardGlyph(guard.dir)
+		}
+	}
+
+	return tiles
+}
+
+func WriteTiles(w io.Writer, tiles []rune, width int) error {
+	var sb strings.Builder
+	for i, tile := range tiles {
+		sb.WriteRune(tile)
+		if (i+1)%width == 0 {
+			sb.WriteRune('\n')
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/**
+ * Advances every patrol to the given step, marking the step into it. Returns the guards' states at
+ * that step; a patrol that has already ended keeps its final state.
+ */
+func (path *PathMarks) Advance(patrols [][]Guard, step int) []Guard {
+	guards := make([]Guard, len(patrols))
+	for i, states := range patrols {
+		if step > 0 && step < len(states) {
+			path.Add(states[step-1], states[step])
+		}
+		guards[i] = states[min(step, len(states)-1)]
+	}
+
+	return guards
+}
+
+func PatrolLength(patrols [][]Guard) int {
+	length := 0
+	for _, states := range patrols {
+		length = max(length, len(states))
+	}
+
+	return length
+}
+
+/**
+ * Writes the whole of every patrol as a single map, with the guards drawn at their starting positions.
+ */
+func RenderPatrol(w io.Writer, grid *Grid, patrols [][]Guard, obstructions []Vec) error {
+	path := NewPathMarks(grid)
+	for step := range PatrolLength(patrols) {
+		path.Advance(patrols, step)
+	}
+
+	starts := make([]Guard, len(patrols))
+	for i, states := range patrols {
+		starts[i] = states[0]
+	}
+
+	return WriteTiles(w, path.Tiles(starts, obstructions), grid.width)
+}
+
+/**
+ * Plays the patrols in the terminal, redrawing the map after every "every" steps. All guards move at
+ * the same time.
+ */
+func AnimatePatrol(w io.Writer, grid *Grid, patrols [][]Guard, every int, delay time.Duration) error {
+	path := NewPathMarks(grid)
+	length := PatrolLength(patrols)
+	for i := range length {
+		guards := path.Advance(patrols, i)
+		if i%every != 0 && i != length-1 {
+			continue
+		}
+
+		// Move the cursor home and clear the screen before each frame.
+		if _, err := io.WriteString(w, "\x1b[H\x1b[2J"); err != nil {
+			return err
+		}
+		if err := WriteTiles(w, path.Tiles(guards, nil), grid.width); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Step %d/%d\n", i, length-1)
+		time.Sleep(delay)
+	}
+
+	return nil
+}
+
+var framePalette = color.Palette{
+	color.RGBA{0xff, 0xff, 0xff, 0xff}, // Floor
+	color.RGBA{0x40, 0x40, 0x40, 0xff}, // Obstruction
+	color.RGBA{0x1f, 0x77, 0xb4, 0xff}, // Path
+	color.RGBA{0xd6, 0x27, 0x28, 0xff}, // Guard
+	color.RGBA{0x2c, 0xa0, 0x2c, 0xff}, // New obstruction
+}
+
+/**
+ * Draws the tiles as an image with "scale" pixels per tile. The path is drawn as lines through the
+ * middle of each tile so that crossings and turns stay visible.
+ */
+func DrawFrame(tiles []rune, width int, scale int) *image.Paletted {
+	height := len(tiles) / width
+	frame := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), framePalette)
+
+	fill := func(x0 int, y0 int, x1 int, y1 int, colour uint8) {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				frame.SetColorIndex(x, y, colour)
+			}
+		}
+	}
+
+	mid := scale / 2
+	for i, tile := range tiles {
+		x, y := (i%width)*scale, (i/width)*scale
+		switch tile {
+		case '#':
+			fill(x, y, x+scale, y+scale, 1)
+		case 'O':
+			fill(x, y, x+scale, y+scale, 4)
+		case '^', '>', 'v', '<', '*':
+			fill(x, y, x+scale, y+scale, 3)
+		case '|':
+			fill(x+mid, y, x+mid+1, y+scale, 2)
+		case '-':
+			fill(x, y+mid, x+scale, y+mid+1, 2)
+		case '+':
+			fill(x+mid, y, x+mid+1, y+scale, 2)
+			fill(x, y+mid, x+scale, y+mid+1, 2)
+		case '/':
+			for d := range scale {
+				frame.SetColorIndex(x+d, y+scale-1-d, 2)
+			}
+		case '\\':
+			for d := range scale {
+				frame.SetColorIndex(x+d, y+d, 2)
+			}
+		}
+	}
+
+	return frame
+}
+
+/**
+ * Encodes the patrols as an animated GIF with one frame every "every" steps. The final frame also
+ * shows the given obstructions.
+ */
+func WritePatrolGIF(w io.Writer, grid *Grid, patrols [][]Guard, obstructions []Vec, every int, scale int, delay time.Duration) error {
+	animation := gif.GIF{}
+	path := NewPathMarks(grid)
+	length := PatrolLength(patrols)
+	for i := range length {
+		guards := path.Advance(patrols, i)
+		last := i == length-1
+		if i%every != 0 && !last {
+			continue
+		}
+
+		var shown []Vec
+		if last {
+			shown = obstructions
+		}
+		animation.Image = append(animation.Image, DrawFrame(path.Tiles(guards, shown), grid.width, scale))
+		animation.Delay = append(animation.Delay, int(delay/(10*time.Millisecond)))
+	}
+
+	return gif.EncodeAll(w, &animation)
+}
+
+/**
+ * Writes the patrols as a numbered sequence of PNG images in the given directory, one every "every"
+ * steps. The final frame also shows the given obstructions.
+ */
+func WritePatrolPNGs(dir string, grid *Grid, patrols [][]Guard, obstructions []Vec, every int, scale int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	path := NewPathMarks(grid)
+	frameNum := 0
+	length := PatrolLength(patrols)
+	for i := range length {
+		guards := path.Advance(patrols, i)
+		last := i == length-1
+		if i%every != 0 && !last {
+			continue
+		}
+
+		var shown []Vec
+		if last {
+			shown = obstructions
+		}
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("frame%05d.png", frameNum)))
+		if err != nil {
+			return err
+		}
+		err = png.Encode(file, DrawFrame(path.Tiles(guards, shown), grid.width, scale))
+		file.Close()
+		if err != nil {
+			return err
+		}
+		frameNum++
+	}
+
+	return nil
+}
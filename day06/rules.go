@@ -0,0 +1,90 @@
+package main
+
+import "fmt"
+
+/**
+ * The eight compass headings, in clockwise order starting from north. A turn of 45 degrees moves one
+ * place along the list.
+ */
+var compass = [8]Vec{{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}}
+
+func CompassIndex(dir Vec) int {
+	for i, heading := range compass {
+		if heading.Equal(dir) {
+			return i
+		}
+	}
+
+	panic("The guard can only face along the grid axes or diagonals.")
+}
+
+/**
+ * How the guard moves around the map. The puzzle's guard turns 90 degrees clockwise when blocked and
+ * leaves the map at its edges. Turning by 45 degrees lets the guard walk diagonally, and wrapping
+ * edges bring the guard back in on the opposite side of the map, so that it never leaves.
+ */
+type Rules struct {
+	clockwise bool
+	turnAngle int // Either 45 or 90 degrees.
+	wrapEdges bool
+}
+
+var PuzzleRules = Rules{clockwise: true, turnAngle: 90, wrapEdges: false}
+
+func NewRules(clockwise bool, turnAngle int, wrapEdges bool) (Rules, error) {
+	if turnAngle != 45 && turnAngle != 90 {
+		return Rules{}, fmt.Errorf("turn angle must be 45 or 90 degrees, not %d", turnAngle)
+	}
+
+	return Rules{clockwise: clockwise, turnAngle: turnAngle, wrapEdges: wrapEdges}, nil
+}
+
+/**
+ * Reports whether these are the puzzle's own rules, which the jump table relies on.
+ */
+func (rules *Rules) IsPuzzle() bool {
+	return *rules == PuzzleRules
+}
+
+/**
+ * Reports whether the guard can ever leave the map. When it can't, every patrol ends in a loop, so
+ * counting the obstructions that cause one tells us nothing.
+ */
+func (rules *Rules) CanLeave() bool {
+	return !rules.wrapEdges
+}
+
+/**
+ * The number of turns it takes the guard to face the way it started.
+ */
+func (rules *Rules) TurnsPerRevolution() int {
+	return 360 / rules.turnAngle
+}
+
+func (rules *Rules) Turn(dir Vec) Vec {
+	steps := rules.turnAngle / 45
+	if !rules.clockwise {
+		steps = len(compass) - steps
+	}
+
+	return compass[(CompassIndex(dir)+steps)%len(compass)]
+}
+
+/**
+ * Returns the tile directly ahead of the guard. With wrapping edges this is always on the map.
+ */
+func (rules *Rules) Ahead(guard *Guard, terrain Terrain) Vec {
+	ahead := guard.pos.Add(guard.dir)
+	if rules.wrapEdges {
+		ahead = terrain.Wrap(ahead)
+	}
+
+	return ahead
+}
+
+/**
+ * Numbers the (position, heading) states of a guard on the grid densely from 0.
+ */
+func StateIndex(guard *Guard, grid *Grid) int {
+	return grid.ToIndex(guard.pos)*len(compass) + CompassIndex(guard.dir)
+}
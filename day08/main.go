@@ -2,10 +2,14 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"iter"
+	"math"
+	"math/bits"
 	"os"
+	"strings"
 )
 
 type vector struct {
@@ -21,41 +25,70 @@ func ToCoords(index int, dimensions vector) vector {
 	return vector{index % dimensions.x, index / dimensions.x}
 }
 
+func ToIndex(pos vector, dimensions vector) int {
+	return pos.y*dimensions.x + pos.x
+}
+
 func InBounds(pos vector, dimensions vector) bool {
 	return pos.x >= 0 && pos.x < dimensions.x && pos.y >= 0 && pos.y < dimensions.y
 }
 
-func PopulateTowersFromReader(r *bufio.Reader) (*map[rune][]int, vector) {
-	antennas := make(map[rune][]int)
+func IsFrequency(ch rune) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+/**
+ * Reads the antenna map, returning the coordinates of the antennas of each frequency along with the
+ * map's dimensions. Only letters and digits are accepted as frequencies. The '#' markers used by the
+ * puzzle's annotated examples are treated as empty tiles when ignoreOverlay is set, and rejected
+ * otherwise. Both "\n" and "\r\n" line endings are accepted, every row must be the same width, and
+ * empty lines are only allowed after the last row.
+ */
+func PopulateTowersFromReader(r *bufio.Reader, ignoreOverlay bool) (map[rune][]vector, vector, error) {
+	antennas := make(map[rune][]vector)
 	dimensions := vector{0, 0}
 
-	index := 0
-	for {
-		ch, _, err := r.ReadRune()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			panic(err)
+	blankLine := 0 // The first empty line, which must be followed only by other empty lines.
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, dimensions, err
 		}
 
-		if ch == '\n' {
-			dimensions.y++
-			continue
-		} else if ch != '.' {
-			if antennas[ch] == nil {
-				antennas[ch] = make([]int, 0, 1)
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) == 0 && blankLine == 0 {
+			blankLine = lineNumber
+		} else if len(line) > 0 {
+			if blankLine > 0 {
+				return nil, dimensions, fmt.Errorf("line %d: empty line inside the map", blankLine)
 			}
-			antennas[ch] = append(antennas[ch], index)
+
+			row := []rune(line)
+			if dimensions.y == 0 {
+				dimensions.x = len(row)
+			} else if len(row) != dimensions.x {
+				return nil, dimensions, fmt.Errorf("line %d: expected %d tiles, found %d", lineNumber, dimensions.x, len(row))
+			}
+
+			for x, ch := range row {
+				switch {
+				case ch == '.' || (ch == '#' && ignoreOverlay):
+					continue
+				case IsFrequency(ch):
+					antennas[ch] = append(antennas[ch], vector{x, dimensions.y})
+				default:
+					return nil, dimensions, fmt.Errorf("line %d, column %d: invalid frequency %q", lineNumber, x+1, ch)
+				}
+			}
+			dimensions.y++
 		}
 
-		// Once the grid's height has been incremented, we know the grid width.
-		if dimensions.y == 0 {
-			dimensions.x++
+		if err == io.EOF {
+			break
 		}
-		index++
 	}
 
-	return &antennas, dimensions
+	return antennas, dimensions, nil
 }
 
 /**
@@ -95,9 +128,31 @@ func GCD(a int, b int) int {
 	return GCD(smaller, r)
 }
 
-func PopulateAntinodes(antennaA int, antennaB int, dimensions vector, cachedAntinodes *map[vector]bool) {
-	p0 := ToCoords(antennaA, dimensions)
-	p1 := ToCoords(antennaB, dimensions)
+/**
+ * A model of where a pair of antennas with the same frequency creates antinodes. Each model marks the
+ * antinodes that lie within the map in the given set.
+ */
+type AntinodeModel func(p0 vector, p1 vector, dimensions vector, cachedAntinodes *map[vector]bool)
+
+/**
+ * Part 1: an antinode lies on the line through both antennas wherever one antenna is twice as far
+ * away as the other. Only the two points outside the pair are considered.
+ */
+func PairwiseAntinodes(p0 vector, p1 vector, dimensions vector, cachedAntinodes *map[vector]bool) {
+	dir := p1.Sub(p0)
+
+	for _, antinode := range []vector{p0.Sub(dir), p1.Add(dir)} {
+		if InBounds(antinode, dimensions) {
+			(*cachedAntinodes)[antinode] = true
+		}
+	}
+}
+
+/**
+ * Part 2: with resonant harmonics, every grid position exactly in line with both antennas is an
+ * antinode, including the antennas themselves.
+ */
+func HarmonicAntinodes(p0 vector, p1 vector, dimensions vector, cachedAntinodes *map[vector]bool) {
 	dir := p1.Sub(p0)
 	gcd := GCD(Abs(dir.x), Abs(dir.y))
 	dir.x /= gcd
@@ -116,6 +171,95 @@ func PopulateAntinodes(antennaA int, antennaB int, dimensions vector, cachedAnti
 	}
 }
 
+/**
+ * A dense set of grid indices.
+ */
+type Bitset []uint64
+
+func NewBitset(size int) Bitset {
+	return make(Bitset, (size+63)/64)
+}
+
+func (set Bitset) Set(i int) {
+	set[i/64] |= 1 << (i % 64)
+}
+
+func (set Bitset) Test(i int) bool {
+	return set[i/64]&(1<<(i%64)) != 0
+}
+
+func (set Bitset) Count() int {
+	count := 0
+	for _, word := range set {
+		count += bits.OnesCount64(word)
+	}
+
+	return count
+}
+
+func FloorDiv(a int, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+
+	return q
+}
+
+func CeilDiv(a int, b int) int {
+	return -FloorDiv(-a, b)
+}
+
+/**
+ * Returns the range of t for which start + t*step lies within [0, length). The range is empty when
+ * tMin > tMax. A step of 0 places no constraint on t, given that the start lies within range.
+ */
+func ClipAxis(start int, step int, length int) (int, int) {
+	switch {
+	case step > 0:
+		return CeilDiv(-start, step), FloorDiv(length-1-start, step)
+	case step < 0:
+		return CeilDiv(length-1-start, step), FloorDiv(-start, step)
+	}
+
+	return math.MinInt, math.MaxInt
+}
+
+/**
+ * The same model as HarmonicAntinodes, but rather than stepping along the line until it leaves the
+ * map, the range of steps that stays on the map is computed up front and the antinodes are marked in
+ * a bitset of grid indices.
+ */
+func HarmonicAntinodeBits(p0 vector, p1 vector, dimensions vector, antinodes Bitset) {
+	dir := p1.Sub(p0)
+	gcd := GCD(Abs(dir.x), Abs(dir.y))
+	dir.x /= gcd
+	dir.y /= gcd
+
+	xMin, xMax := ClipAxis(p0.x, dir.x, dimensions.x)
+	yMin, yMax := ClipAxis(p0.y, dir.y, dimensions.y)
+	tMin, tMax := max(xMin, yMin), min(xMax, yMax)
+
+	index := ToIndex(p0, dimensions) + tMin*(dir.y*dimensions.x+dir.x)
+	stride := dir.y*dimensions.x + dir.x
+	for t := tMin; t <= tMax; t++ {
+		antinodes.Set(index)
+		index += stride
+	}
+}
+
+func CountHarmonicAntinodes(frequencyMapping map[rune][]vector, dimensions vector) int {
+	antinodes := NewBitset(dimensions.x * dimensions.y)
+
+	for _, antennas := range frequencyMapping {
+		for antennaA, antennaB := range AllPairs(antennas) {
+			HarmonicAntinodeBits(antennaA, antennaB, dimensions, antinodes)
+		}
+	}
+
+	return antinodes.Count()
+}
+
 func AllPairs[T any](sequence []T) iter.Seq2[T, T] {
 	return func(yield func(T, T) bool) {
 		if len(sequence) <= 1 {
@@ -131,22 +275,36 @@ func AllPairs[T any](sequence []T) iter.Seq2[T, T] {
 	}
 }
 
-func FindAllAntinodes(frequencyMapping *map[rune][]int, dimensions vector) int {
+/**
+ * Returns the set of every antinode location created by pairs of antennas with the same frequency,
+ * according to the given model.
+ */
+func FindAntinodeSet(frequencyMapping map[rune][]vector, dimensions vector, model AntinodeModel) map[vector]bool {
 	antinodeLocations := make(map[vector]bool)
 
-	for _, antennas := range *frequencyMapping {
+	for _, antennas := range frequencyMapping {
 		if len(antennas) == 1 {
 			continue
 		}
 		for antennaA, antennaB := range AllPairs(antennas) {
-			PopulateAntinodes(antennaA, antennaB, dimensions, &antinodeLocations)
+			model(antennaA, antennaB, dimensions, &antinodeLocations)
 		}
 	}
 
-	return len(antinodeLocations)
+	return antinodeLocations
+}
+
+func FindAllAntinodes(frequencyMapping map[rune][]vector, dimensions vector, model AntinodeModel) int {
+	return len(FindAntinodeSet(frequencyMapping, dimensions, model))
 }
 
 func main() {
+	render := flag.String("render", "", "draw the map with the antinodes of a model: \"pairwise\" or \"harmonic\"")
+	frequency := flag.String("freq", "", "only draw the antennas and antinodes of this frequency")
+	colour := flag.Bool("colour", false, "highlight antinodes with ANSI colours")
+	ignoreOverlay := flag.Bool("ignore-overlay", false, "treat '#' antinode markers in the input as empty tiles")
+	flag.Parse()
+
 	file, err := os.Open("./input.txt")
 	if err != nil {
 		panic(err)
@@ -154,8 +312,30 @@ func main() {
 	defer file.Close()
 
 	reader := bufio.NewReader(file)
-	freqToLocation, dimensions := PopulateTowersFromReader(reader)
-	numAntinodes := FindAllAntinodes(freqToLocation, dimensions)
+	freqToLocation, dimensions, err := PopulateTowersFromReader(reader, *ignoreOverlay)
+	if err != nil {
+		panic(err)
+	}
+	pairwise := FindAllAntinodes(freqToLocation, dimensions, PairwiseAntinodes)
+	harmonic := CountHarmonicAntinodes(freqToLocation, dimensions)
+
+	if *render != "" {
+		models := map[string]AntinodeModel{"pairwise": PairwiseAntinodes, "harmonic": HarmonicAntinodes}
+		model, ok := models[*render]
+		if !ok {
+			panic(fmt.Sprintf("unknown antinode model %q", *render))
+		}
+
+		shown := freqToLocation
+		if *frequency != "" {
+			shown = FilterFrequency(freqToLocation, []rune(*frequency)[0])
+		}
+		antinodes := FindAntinodeSet(shown, dimensions, model)
+		if err := RenderAntennaMap(os.Stdout, shown, dimensions, antinodes, *colour); err != nil {
+			panic(err)
+		}
+	}
 
-	fmt.Printf("Number of antinodes: %d\n", numAntinodes)
+	fmt.Printf("Number of antinodes (pairwise): %d\n", pairwise)
+	fmt.Printf("Number of antinodes (harmonic): %d\n", harmonic)
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var exampleMap = strings.Join([]string{
+	"............",
+	"........0...",
+	".....0......",
+	".......0....",
+	"....0.......",
+	"......A.....",
+	"............",
+	"............",
+	"........A...",
+	".........A..",
+	"............",
+	"............",
+}, "\n")
+
+func TestExampleAntinodes(t *testing.T) {
+	freqToLocation, dimensions, err := PopulateTowersFromReader(bufio.NewReader(strings.NewReader(exampleMap)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		model    AntinodeModel
+		count    int
+		expected []vector // A few of the antinodes drawn in the puzzle.
+		excluded []vector // A few tiles that aren't antinodes.
+	}{
+		// (6, 5) is an antinode on top of an antenna.
+		{"pairwise", PairwiseAntinodes, 14, []vector{{6, 0}, {11, 0}, {3, 1}, {6, 5}, {10, 11}}, []vector{{0, 0}, {8, 1}, {9, 9}}},
+		// With harmonics, every antenna that shares its frequency with another is also an antinode.
+		{"harmonic", HarmonicAntinodes, 34, []vector{{0, 0}, {1, 0}, {8, 1}, {6, 5}, {9, 9}, {11, 11}}, []vector{{2, 0}, {0, 11}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			antinodes := FindAntinodeSet(freqToLocation, dimensions, test.model)
+			if len(antinodes) != test.count {
+				t.Errorf("found %d antinodes, expected %d", len(antinodes), test.count)
+			}
+			for _, pos := range test.expected {
+				if !antinodes[pos] {
+					t.Errorf("expected an antinode at %v", pos)
+				}
+			}
+			for _, pos := range test.excluded {
+				if antinodes[pos] {
+					t.Errorf("unexpected antinode at %v", pos)
+				}
+			}
+		})
+	}
+
+	if count := CountHarmonicAntinodes(freqToLocation, dimensions); count != 34 {
+		t.Errorf("counted %d harmonic antinodes analytically, expected 34", count)
+	}
+}
+
+func TestPopulateTowersFromReader(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		ignoreOverlay bool
+		antennas      map[rune][]vector
+		dimensions    vector
+		wantErr       string
+	}{
+		{name: "lf", input: "a..\n.B.\n", antennas: map[rune][]vector{'a': {{0, 0}}, 'B': {{1, 1}}}, dimensions: vector{3, 2}},
+		{name: "crlf", input: "a..\r\n.B.\r\n", antennas: map[rune][]vector{'a': {{0, 0}}, 'B': {{1, 1}}}, dimensions: vector{3, 2}},
+		{name: "no final newline", input: "..0\n..0", antennas: map[rune][]vector{'0': {{2, 0}, {2, 1}}}, dimensions: vector{3, 2}},
+		{name: "trailing empty lines", input: "0.\n.0\n\n\r\n", antennas: map[rune][]vector{'0': {{0, 0}, {1, 1}}}, dimensions: vector{2, 2}},
+		{name: "overlay ignored", input: "#a\n.#\n", ignoreOverlay: true, antennas: map[rune][]vector{'a': {{1, 0}}}, dimensions: vector{2, 2}},
+		{name: "overlay rejected", input: "..\n#a\n", wantErr: "line 2, column 1: invalid frequency '#'"},
+		{name: "invalid frequency", input: "a.\n.*\n", wantErr: "line 2, column 2: invalid frequency '*'"},
+		{name: "ragged", input: "a..\n.B\n", wantErr: "line 2: expected 3 tiles, found 2"},
+		{name: "interior empty line", input: "a.\r\n..\r\n\r\n.b", wantErr: "line 3: empty line inside the map"},
+		{name: "ragged after the first row", input: "..\n..\n...\n", wantErr: "line 3: expected 2 tiles, found 3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			antennas, dimensions, err := PopulateTowersFromReader(bufio.NewReader(strings.NewReader(test.input)), test.ignoreOverlay)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("expected error %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dimensions != test.dimensions {
+				t.Errorf("dimensions %v, expected %v", dimensions, test.dimensions)
+			}
+			if !maps.EqualFunc(antennas, test.antennas, slices.Equal) {
+				t.Errorf("antennas %v, expected %v", antennas, test.antennas)
+			}
+		})
+	}
+}
+
+/**
+ * Generates a square map of the given size with a number of frequencies, each with the given number
+ * of antennas at distinct random positions.
+ */
+func SyntheticTowers(size int, frequencies int, antennasPerFrequency int, seed uint64) (map[rune][]vector, vector) {
+	const frequencyRunes = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	dimensions := vector{size, size}
+	occupied := make(map[int]bool)
+	antennas := make(map[rune][]vector)
+	for _, freq := range frequencyRunes[:min(frequencies, len(frequencyRunes))] {
+		for range antennasPerFrequency {
+			index := rng.IntN(size * size)
+			for occupied[index] {
+				index = rng.IntN(size * size)
+			}
+			occupied[index] = true
+			antennas[freq] = append(antennas[freq], ToCoords(index, dimensions))
+		}
+	}
+
+	return antennas, dimensions
+}
+
+type syntheticMap struct {
+	size                 int
+	frequencies          int
+	antennasPerFrequency int
+}
+
+var syntheticMaps = []syntheticMap{
+	{50, 4, 20},
+	{500, 4, 200},
+	{2000, 4, 200},
+}
+
+/**
+ * Maps at the scale the analytic count is meant for. Stepping through them would take minutes.
+ */
+var largeSyntheticMaps = []syntheticMap{
+	{10000, 4, 1000},
+	{10000, 4, 2000},
+}
+
+func TestHarmonicModelsAgree(t *testing.T) {
+	for seed := range uint64(20) {
+		freqToLocation, dimensions := SyntheticTowers(40, 3, 15, seed)
+		stepped := FindAllAntinodes(freqToLocation, dimensions, HarmonicAntinodes)
+		if analytic := CountHarmonicAntinodes(freqToLocation, dimensions); analytic != stepped {
+			t.Errorf("seed %d: counted %d antinodes analytically, %d by stepping", seed, analytic, stepped)
+		}
+	}
+}
+
+func benchmarkHarmonic(b *testing.B, maps []syntheticMap, count func(map[rune][]vector, vector) int) {
+	for _, m := range maps {
+		b.Run(fmt.Sprintf("%dx%d/%dx%d", m.size, m.size, m.frequencies, m.antennasPerFrequency), func(b *testing.B) {
+			freqToLocation, dimensions := SyntheticTowers(m.size, m.frequencies, m.antennasPerFrequency, 2024)
+			for b.Loop() {
+				count(freqToLocation, dimensions)
+			}
+		})
+	}
+}
+
+func BenchmarkHarmonicAntinodes(b *testing.B) {
+	benchmarkHarmonic(b, syntheticMaps, func(freqToLocation map[rune][]vector, dimensions vector) int {
+		return FindAllAntinodes(freqToLocation, dimensions, HarmonicAntinodes)
+	})
+}
+
+func BenchmarkCountHarmonicAntinodes(b *testing.B) {
+	benchmarkHarmonic(b, append(syntheticMaps, largeSyntheticMaps...), CountHarmonicAntinodes)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/**
+ * Returns a mapping containing only the antennas of the given frequency.
+ */
+func FilterFrequency(frequencyMapping map[rune][]vector, frequency rune) map[rune][]vector {
+	filtered := make(map[rune][]vector)
+	if antennas, ok := frequencyMapping[frequency]; ok {
+		filtered[frequency] = antennas
+	}
+
+	return filtered
+}
+
+/**
+ * Writes the map as the puzzle draws it: antennas by their frequency, antinodes as '#' and empty
+ * tiles as '.'. An antenna that is also an antinode is drawn as the antenna, so without colour those
+ * antennas are listed beneath the map. When colour is set, antinodes are drawn in red and antennas
+ * that are also antinodes are shown in reverse video instead.
+ */
+func RenderAntennaMap(w io.Writer, frequencyMapping map[rune][]vector, dimensions vector, antinodes map[vector]bool, colour bool) error {
+	tiles := make([]rune, dimensions.x*dimensions.y)
+	for i := range tiles {
+		tiles[i] = '.'
+	}
+	for frequency, antennas := range frequencyMapping {
+		for _, antenna := range antennas {
+			tiles[ToIndex(antenna, dimensions)] = frequency
+		}
+	}
+
+	var sb strings.Builder
+	covered := make([]string, 0) // Antennas hidden under antinodes, for the plain-text listing.
+	for i, tile := range tiles {
+		isAntinode := antinodes[ToCoords(i, dimensions)]
+		if isAntinode && tile != '.' && !colour {
+			pos := ToCoords(i, dimensions)
+			covered = append(covered, fmt.Sprintf("%c at (%d, %d)", tile, pos.x, pos.y))
+		}
+
+		switch {
+		case isAntinode && tile != '.' && colour:
+			fmt.Fprintf(&sb, "\x1b[7m%c\x1b[0m", tile)
+		case isAntinode && tile == '.' && colour:
+			sb.WriteString("\x1b[31m#\x1b[0m")
+		case isAntinode && tile == '.':
+			sb.WriteRune('#')
+		default:
+			sb.WriteRune(tile)
+		}
+
+		if (i+1)%dimensions.x == 0 {
+			sb.WriteRune('\n')
+		}
+	}
+	if len(covered) > 0 {
+		fmt.Fprintf(&sb, "Antennas on antinodes: %s\n", strings.Join(covered, ", "))
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const freeBlock = -1
+
+/**
+ * A file in the JSON input format: its ID, its size, and the free space after it.
+ */
+type FileEntry struct {
+	ID   int `json:"id"`
+	Size int `json:"size"`
+	Free int `json:"free"`
+}
+
+/**
+ * Parses a disk map in which the sizes are separated by whitespace, so they can be more than one
+ * digit long. As in the puzzle's format, the sizes alternate between files and free space.
+ */
+func ParseSizeList(r io.Reader) (FileSystem, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+
+	sizes := make([]int, 0)
+	for scanner.Scan() {
+		size, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			return FileSystem{}, fmt.Errorf("size %d: %q isn't a number", len(sizes)+1, scanner.Text())
+		}
+		if size < 0 {
+			return FileSystem{}, fmt.Errorf("size %d: %d is negative", len(sizes)+1, size)
+		}
+		sizes = append(sizes, size)
+	}
+	if err := scanner.Err(); err != nil {
+		return FileSystem{}, err
+	}
+
+	return FromSizes(sizes), nil
+}
+
+/**
+ * Parses a JSON list of files in disk order. Unlike the disk map formats, the IDs are given rather
+ * than implied by position, so they need only be unique.
+ */
+func ParseFileList(r io.Reader) (FileSystem, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var entries []FileEntry
+	if err := decoder.Decode(&entries); err != nil {
+		return FileSystem{}, err
+	}
+
+	fileSystem := FileSystem{}
+	seenIDs := make(map[int]bool)
+	for i, entry := range entries {
+		switch {
+		case entry.ID < 0:
+			return FileSystem{}, fmt.Errorf("file %d: id %d is negative", i, entry.ID)
+		case seenIDs[entry.ID]:
+			return FileSystem{}, fmt.Errorf("file %d: id %d appears more than once", i, entry.ID)
+		case entry.Size < 0 || entry.Free < 0:
+			return FileSystem{}, fmt.Errorf("file %d: negative size %d or free space %d", i, entry.Size, entry.Free)
+		}
+
+		seenIDs[entry.ID] = true
+		fileSystem.AppendFile(entry.ID, entry.Size, entry.Free)
+	}
+
+	return fileSystem, nil
+}
+
+/**
+ * Parses the input in the given format: "digits" for the puzzle's disk map, "sizes" for
+ * whitespace-separated sizes, or "json" for a list of files.
+ */
+func ParseFileSystem(input []byte, format string) (FileSystem, error) {
+	switch format {
+	case "digits":
+		return PopulateFileSystem(bufio.NewReader(bytes.NewReader(input)))
+	case "sizes":
+		return ParseSizeList(bytes.NewReader(input))
+	case "json":
+		return ParseFileList(bytes.NewReader(input))
+	}
+
+	return FileSystem{}, fmt.Errorf("unknown input format %q", format)
+}
+
+/**
+ * Serialises the file system back into the compact disk-map format: the length of each file followed
+ * by the free space after it. As in the puzzle input, the free space after the last file is left off
+ * when there is none. Files are written in list order, so after files have been moved their IDs are
+ * no longer those implied by their position in the map.
+ */
+func (fileSys *FileSystem) DiskMap() (string, error) {
+	var sb strings.Builder
+	for f := fileSys.start; f != nil; f = f.next {
+		if f.length > 9 || f.freeSpace > 9 {
+			return "", fmt.Errorf("file %d doesn't fit in a single-digit disk map (size %d, free space %d)", f.id, f.length, f.freeSpace)
+		}
+
+		sb.WriteByte(byte('0' + f.length))
+		if f.next != nil || f.freeSpace > 0 {
+			sb.WriteByte(byte('0' + f.freeSpace))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+/**
+ * Returns the ID of the file in each block of the disk, or freeBlock for free blocks.
+ */
+func (fileSys *FileSystem) Blocks() []int {
+	blocks := make([]int, 0)
+	for f := fileSys.start; f != nil; f = f.next {
+		for range f.length {
+			blocks = append(blocks, f.id)
+		}
+		for range f.freeSpace {
+			blocks = append(blocks, freeBlock)
+		}
+	}
+
+	return blocks
+}
+
+/**
+ * Draws a block as the puzzle does: free blocks as '.', and files by their ID. IDs that don't fit in
+ * a single digit are drawn as '#'.
+ */
+func BlockGlyph(id int) byte {
+	switch {
+	case id == freeBlock:
+		return '.'
+	case id < 10:
+		return byte('0' + id)
+	}
+
+	return '#'
+}
+
+func BlockString(blocks []int) string {
+	glyphs := make([]byte, len(blocks))
+	for i, id := range blocks {
+		glyphs[i] = BlockGlyph(id)
+	}
+
+	return string(glyphs)
+}
+
+/**
+ * Writes the blocks before and after a rearrangement in rows of the given width, with a row of '^'
+ * beneath marking the blocks that changed. Rows in which nothing changed are skipped.
+ */
+func WriteDiff(w io.Writer, before []int, after []int, width int) error {
+	if width < 1 {
+		return fmt.Errorf("diff rows must be at least 1 block wide, not %d", width)
+	}
+
+	var sb strings.Builder
+	length := max(len(before), len(after))
+	blockAt := func(blocks []int, i int) int {
+		if i < len(blocks) {
+			return blocks[i]
+		}
+		return freeBlock
+	}
+
+	for rowStart := 0; rowStart < length; rowStart += width {
+		rowEnd := min(rowStart+width, length)
+		var old, updated, marks strings.Builder
+		changed := false
+		for i := rowStart; i < rowEnd; i++ {
+			a, b := blockAt(before, i), blockAt(after, i)
+			old.WriteByte(BlockGlyph(a))
+			updated.WriteByte(BlockGlyph(b))
+			if a != b {
+				marks.WriteByte('^')
+				changed = true
+			} else {
+				marks.WriteByte(' ')
+			}
+		}
+
+		if changed {
+			fmt.Fprintf(&sb, "%8d - %s\n", rowStart, old.String())
+			fmt.Fprintf(&sb, "%8s + %s\n", "", updated.String())
+			fmt.Fprintf(&sb, "%8s   %s\n", "", strings.TrimRight(marks.String(), " "))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
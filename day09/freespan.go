@@ -0,0 +1,104 @@
+package main
+
+/**
+ * Indexes the free spans of a file system by position, so that the left-most span of at least a given
+ * length is found in O(log n) however long the spans are. Each span the file system starts with gets
+ * a slot, in disk order, and a segment tree holds the largest free space under each subtree. A file
+ * that moves into a span leaves what remains of it after the moved file, so the moved file takes
+ * over the span's slot. Spans that grow when a file moves away keep their old size in the index, but
+ * they always lie to the right of the files still to be moved, so they are never wanted.
+ */
+type FreeSpanIndex struct {
+	largest []int       // The segment tree. The root is at 1, and the leaves start at len(nodes).
+	nodes   []*FileNode // The node that each slot's span follows.
+	slots   map[*FileNode]int
+}
+
+func NewFreeSpanIndex(fileSys *FileSystem) *FreeSpanIndex {
+	count := 0
+	for f := fileSys.start; f != nil; f = f.next {
+		count++
+	}
+	leaves := 1
+	for leaves < count {
+		leaves *= 2
+	}
+
+	index := FreeSpanIndex{largest: make([]int, 2*leaves), nodes: make([]*FileNode, leaves), slots: make(map[*FileNode]int, count)}
+	slot := 0
+	for f := fileSys.start; f != nil; f = f.next {
+		index.nodes[slot] = f
+		index.slots[f] = slot
+		index.largest[leaves+slot] = f.freeSpace
+		slot++
+	}
+	for i := leaves - 1; i > 0; i-- {
+		index.largest[i] = max(index.largest[2*i], index.largest[2*i+1])
+	}
+
+	return &index
+}
+
+func (index *FreeSpanIndex) update(slot int, freeSpace int) {
+	i := len(index.nodes) + slot
+	index.largest[i] = freeSpace
+	for i > 1 {
+		i /= 2
+		index.largest[i] = max(index.largest[2*i], index.largest[2*i+1])
+	}
+}
+
+/**
+ * Files the free span after the given node. A node without a slot of its own is a file that has just
+ * moved into the span after the node before it, and takes over that span's slot.
+ */
+func (index *FreeSpanIndex) Add(node *FileNode) {
+	slot, ok := index.slots[node]
+	if !ok {
+		if slot, ok = index.slots[node.prev]; !ok {
+			return
+		}
+		delete(index.slots, node.prev)
+		index.nodes[slot] = node
+		index.slots[node] = slot
+	}
+
+	index.update(slot, node.freeSpace)
+}
+
+/**
+ * Removes and returns the node with the left-most free span of at least the given length that starts
+ * before the given address. Returns nil if there isn't one.
+ */
+func (index *FreeSpanIndex) TakeLeftmost(length int, before int) *FileNode {
+	length = max(length, 1)
+	if index.largest[1] < length {
+		return nil
+	}
+
+	// Descend towards the left-most leaf with enough space.
+	i := 1
+	for i < len(index.nodes) {
+		if index.largest[2*i] >= length {
+			i = 2 * i
+		} else {
+			i = 2*i + 1
+		}
+	}
+
+	slot := i - len(index.nodes)
+	node := index.nodes[slot]
+	if node.address+node.length >= before {
+		return nil
+	}
+	index.update(slot, 0)
+
+	return node
+}
+
+/**
+ * Places files with first-fit: the left-most span that the file fits in.
+ */
+func (index *FreeSpanIndex) Take(file *FileNode) *FileNode {
+	return index.TakeLeftmost(file.length, file.address)
+}
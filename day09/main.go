@@ -2,9 +2,12 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"time"
 )
 
 type FileNode struct {
@@ -17,9 +20,12 @@ type FileNode struct {
 }
 
 type FileSystem struct {
-	start *FileNode
-	end   *FileNode
-	size  int
+	start      *FileNode
+	end        *FileNode
+	size       int
+	lengths    map[int]int // The length of each file on the disk, by ID, as first appended.
+	splitFiles bool        // Set once block-level compaction may have split files across several nodes.
+	debug      bool        // When set, the list is validated after every move.
 }
 
 func NewFileNode(address int, id int, length int, freeSpace int) *FileNode {
@@ -38,46 +44,79 @@ func (list *FileSystem) Append(newFileNode *FileNode) {
 	if list.start == nil {
 		list.start = list.end
 	}
+	if list.lengths == nil {
+		list.lengths = make(map[int]int)
+	}
+	list.lengths[newFileNode.id] += newFileNode.length
 }
 
-func RuneToDigit(ch rune) int {
-	return int(ch - '0')
+/**
+ * Appends a file of the given size, followed by the given amount of free space, to the end of the disk.
+ */
+func (list *FileSystem) AppendFile(id int, length int, freeSpace int) {
+	list.Append(NewFileNode(list.size, id, length, freeSpace))
+	list.size += length + freeSpace
 }
 
-func PopulateFileSystem(r *bufio.Reader) FileSystem {
+/**
+ * Builds a file system from alternating file sizes and free space, as given by a disk map. Files are
+ * numbered in the order they appear.
+ */
+func FromSizes(sizes []int) FileSystem {
 	fileSystem := FileSystem{}
+	for i := 0; i < len(sizes); i += 2 {
+		freeSpace := 0
+		if i+1 < len(sizes) {
+			freeSpace = sizes[i+1]
+		}
+		fileSystem.AppendFile(i/2, sizes[i], freeSpace)
+	}
 
-	var id int = 0
-	toggle := true
-	for {
+	return fileSystem
+}
+
+func RuneToDigit(ch rune) int {
+	return int(ch - '0')
+}
+
+/**
+ * Parses the puzzle's disk map, in which every size is a single digit. The map ends at the first line
+ * break; anything other than whitespace after it is an error.
+ */
+func PopulateFileSystem(r *bufio.Reader) (FileSystem, error) {
+	sizes := make([]int, 0)
+	for position := 0; ; position++ {
 		ch, _, err := r.ReadRune()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			panic(err)
+			return FileSystem{}, err
 		}
 
-		if ch == '\n' {
+		if ch == '\n' || ch == '\r' {
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				return FileSystem{}, err
+			}
+			if len(bytes.TrimSpace(rest)) > 0 {
+				return FileSystem{}, fmt.Errorf("position %d: unexpected content after the end of the disk map", position)
+			}
 			break
 		}
 
-		value := RuneToDigit(ch)
-		if toggle {
-			file := NewFileNode(fileSystem.size, id, value, 0)
-			fileSystem.Append(file)
-		} else {
-			fileSystem.end.freeSpace = value
-			id++
+		if ch < '0' || ch > '9' {
+			return FileSystem{}, fmt.Errorf("position %d: %q isn't a digit", position, ch)
 		}
-		fileSystem.size += int(value)
-
-		toggle = !toggle
+		sizes = append(sizes, RuneToDigit(ch))
 	}
 
-	return fileSystem
+	return FromSizes(sizes), nil
 }
 
-func MoveFile(left *FileNode, right *FileNode, fileSys *FileSystem) {
+/**
+ * Moves the right file into the free space after the left file, returning the node that now holds it.
+ */
+func MoveFile(left *FileNode, right *FileNode, fileSys *FileSystem) *FileNode {
 	// Create a new node to represent the right-most file moving to the next free space.
 	newAddress := left.address + left.length
 	movedFile := NewFileNode(newAddress, right.id, right.length, left.freeSpace-right.length)
@@ -91,10 +130,10 @@ func MoveFile(left *FileNode, right *FileNode, fileSys *FileSystem) {
 	left.freeSpace = 0
 
 	// Sever the connections to the right node.
+	// The disk doesn't shrink: the space the right node took up is given to the node before it.
 	right.prev.next = right.next
 	if right == fileSys.end {
 		fileSys.end = right.prev
-		fileSys.size -= (right.length + right.freeSpace)
 	}
 	if right.next != nil {
 		right.next.prev = right.prev
@@ -107,6 +146,9 @@ func MoveFile(left *FileNode, right *FileNode, fileSys *FileSystem) {
 	if right.length < 0 || fileSys.end.freeSpace < 0 {
 		panic("File size can't be negative.")
 	}
+	fileSys.CheckMove()
+
+	return movedFile
 }
 
 func SeekFit(openFile *FileNode, toFit *FileNode) (*FileNode, bool) {
@@ -130,12 +172,59 @@ func SeekFreeSpace(file *FileNode, freeSpace int) *FileNode {
 	return file
 }
 
-func Defrag(fileSystem FileSystem) {
+/**
+ * Part 2: moves each whole file, once, from the right-most file leftwards, into the free span chosen
+ * by the placement strategy. Returns the number of files moved. With FirstFit, the free spans are
+ * found from an index of spans by position, so each file takes O(log n) to place.
+ */
+func Defrag(fileSystem *FileSystem, strategy PlacementStrategy) int {
+	spans := strategy(fileSystem)
+
+	moves := 0
+	cachedIDs := make(map[int]bool)
+	for currentFile := fileSystem.end; currentFile != nil; currentFile = currentFile.prev {
+		// Ignore files that we've already moved.
+		if cachedIDs[currentFile.id] {
+			continue
+		}
+		cachedIDs[currentFile.id] = true
+
+		openFile := spans.Take(currentFile)
+		if openFile != nil {
+			// Whatever space the file doesn't use is still free for the files after it.
+			spans.Add(MoveFile(openFile, currentFile, fileSystem))
+			moves++
+		}
+	}
+
+	return moves
+}
+
+/**
+ * Defrags in passes until a pass moves nothing. A file that didn't fit anywhere may fit into the space
+ * left by a file to its left moving on a later pass. Returns the total number of files moved.
+ */
+func DefragRepeated(fileSystem *FileSystem, strategy PlacementStrategy) int {
+	moves := 0
+	for {
+		passMoves := Defrag(fileSystem, strategy)
+		if passMoves == 0 {
+			return moves
+		}
+		moves += passMoves
+	}
+}
+
+/**
+ * The same as Defrag, but searching for free spans by walking the list from the left-most free
+ * span for every file. Kept as a reference for Defrag.
+ */
+func DefragLinear(fileSystem *FileSystem) {
 	firstSpace := SeekFreeSpace(fileSystem.start, 1) // The left-most file with any available space.
 	currentFile := fileSystem.end                    // The file that we're currently attempting to move.
 
 	cachedIDs := make(map[int]bool)
-	for firstSpace.address+firstSpace.length < currentFile.address {
+	for firstSpace != nil && firstSpace.address+firstSpace.length < currentFile.address {
 		// Ignore files that we've already moved.
 		if cachedIDs[currentFile.id] {
 			currentFile = currentFile.prev
@@ -146,7 +235,7 @@ func Defrag(fileSystem FileSystem) {
 		// Look for the first file with enough space for the current file.
 		openFile, found := SeekFit(firstSpace, currentFile)
 		if found {
-			MoveFile(openFile, currentFile, &fileSystem)
+			MoveFile(openFile, currentFile, fileSystem)
 			firstSpace = SeekFreeSpace(firstSpace, 1)
 		}
 
@@ -154,6 +243,46 @@ func Defrag(fileSystem FileSystem) {
 	}
 }
 
+/**
+ * Moves as many blocks of the right-most file as fit into the free space after the given node. The
+ * moved blocks become a new node directly after it, splitting the right-most file in two if it
+ * doesn't fit entirely. The right-most file is removed once all of its blocks have been moved.
+ */
+func MoveBlocks(left *FileNode, fileSys *FileSystem) {
+	right := fileSys.end
+	count := min(left.freeSpace, right.length)
+	fileSys.splitFiles = true
+
+	movedBlocks := NewFileNode(left.address+left.length, right.id, count, left.freeSpace-count)
+	movedBlocks.prev = left
+	movedBlocks.next = left.next
+	left.next.prev = movedBlocks
+	left.next = movedBlocks
+	left.freeSpace = 0
+
+	// The blocks left behind become free space at the end of the disk.
+	right.length -= count
+	right.freeSpace += count
+	if right.length == 0 {
+		fileSys.end = right.prev
+		fileSys.end.next = nil
+		fileSys.end.freeSpace += right.freeSpace
+	}
+	fileSys.CheckMove()
+}
+
+/**
+ * Part 1: moves file blocks from the end of the disk into the left-most free block, until there are
+ * no gaps left between the files. Runs of blocks that fit together are moved in a single step.
+ */
+func Compact(fileSystem *FileSystem) {
+	firstSpace := SeekFreeSpace(fileSystem.start, 1) // The left-most file with any available space.
+	for firstSpace != nil && firstSpace != fileSystem.end {
+		MoveBlocks(firstSpace, fileSystem)
+		firstSpace = SeekFreeSpace(firstSpace, 1)
+	}
+}
+
 func Sum(start int, end int) int {
 	return (end - start + 1) * (start + end) / 2
 }
@@ -185,16 +314,57 @@ func Check(e error) {
 }
 
 func main() {
-	const inputName = "./input"
+	diff := flag.Bool("diff", false, "show the disk blocks that compaction and defrag changed")
+	debug := flag.Bool("debug", false, "validate the file system after every move")
+	fuzzRuns := flag.Int("fuzz", 0, "instead of solving the input, check compaction and defrag on this many random disk maps")
+	fuzzDigits := flag.Int("fuzz-digits", 40, "maximum number of digits in each random disk map")
+	width := flag.Int("width", 64, "number of blocks per row in the diff")
+	input := flag.String("input", "./input.txt", "the disk map to read")
+	strategyName := flag.String("strategy", "first-fit", "where defrag moves files: \"first-fit\", \"best-fit\", \"worst-fit\" or \"repeated\"")
+	compare := flag.Bool("compare", false, "instead of solving the input, compare the defrag strategies on it")
+	format := flag.String("format", "digits", "format of the input: \"digits\", \"sizes\" (whitespace-separated) or \"json\"")
+	flag.Parse()
+
+	if *diff && *width < 1 {
+		Check(fmt.Errorf("-width must be at least 1 block, not %d", *width))
+	}
+	if *fuzzRuns > 0 {
+		Check(Fuzz(*fuzzRuns, *fuzzDigits, uint64(time.Now().UnixNano())))
+		fmt.Printf("%d random disk maps passed\n", *fuzzRuns)
+		return
+	}
 
-	file, err := os.Open(fmt.Sprintf("%s.txt", inputName))
+	diskMap, err := os.ReadFile(*input)
 	Check(err)
-	defer file.Close()
+	if *compare {
+		Check(CompareStrategies(os.Stdout, diskMap, *format))
+		return
+	}
+	strategy, err := FindStrategy(*strategyName)
+	Check(err)
+
+	compacted, err := ParseFileSystem(diskMap, *format)
+	Check(err)
+	compacted.debug = *debug
+	var original []int
+	if *diff {
+		original = compacted.Blocks()
+	}
+	Compact(&compacted)
 
-	reader := bufio.NewReader(file)
-	fileSystem := PopulateFileSystem(reader)
-	Defrag(fileSystem)
+	defragged, err := ParseFileSystem(diskMap, *format)
+	Check(err)
+	defragged.debug = *debug
+	strategy.defrag(&defragged)
+
+	if *diff {
+		fmt.Println("Compacted blocks:")
+		Check(WriteDiff(os.Stdout, original, compacted.Blocks(), *width))
+		fmt.Println("Defragged files:")
+		Check(WriteDiff(os.Stdout, original, defragged.Blocks(), *width))
+	}
 
-	// WriteListToFile(fileSystem, fmt.Sprintf("%s_defrag.txt", inputName))
-	fmt.Printf("Checksum: %d\n", CalculateChecksum(fileSystem))
+	// WriteListToFile(defragged, "./input_defrag.txt")
+	fmt.Printf("Checksum (blocks): %d\n", CalculateChecksum(compacted))
+	fmt.Printf("Checksum  (files): %d\n", CalculateChecksum(defragged))
 }
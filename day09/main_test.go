@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+func parseDiskMap(tb testing.TB, diskMap []byte) FileSystem {
+	tb.Helper()
+
+	fileSys, err := PopulateFileSystem(bufio.NewReader(bytes.NewReader(diskMap)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return fileSys
+}
+
+/**
+ * Generates a random disk map with the given number of digits. Files are never empty.
+ */
+func SyntheticDiskMap(digits int, seed uint64) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	diskMap := make([]byte, digits)
+	for i := range diskMap {
+		if i%2 == 0 {
+			diskMap[i] = byte('1' + rng.IntN(9))
+		} else {
+			diskMap[i] = byte('0' + rng.IntN(10))
+		}
+	}
+
+	return diskMap
+}
+
+/**
+ * Defrags a fresh copy of a synthetic disk map of each size on every iteration. Parsing isn't timed.
+ */
+func benchmarkDefrag(b *testing.B, defrag func(*FileSystem), sizes []int) {
+	for _, digits := range sizes {
+		diskMap := SyntheticDiskMap(digits, 2024)
+		b.Run(fmt.Sprintf("%d-digits", digits), func(b *testing.B) {
+			for b.Loop() {
+				b.StopTimer()
+				fileSys := parseDiskMap(b, diskMap)
+				b.StartTimer()
+				defrag(&fileSys)
+			}
+		})
+	}
+}
+
+func BenchmarkDefrag(b *testing.B) {
+	benchmarkDefrag(b, func(fileSys *FileSystem) { Defrag(fileSys, FirstFit) }, []int{10_000, 100_000, 1_000_000})
+}
+
+/**
+ * The linear defrag is quadratic, so a million digits would take minutes per iteration.
+ */
+func BenchmarkDefragLinear(b *testing.B) {
+	benchmarkDefrag(b, DefragLinear, []int{10_000, 100_000})
+}
+
+const exampleDiskMap = "2333133121414131402"
+
+func TestDiskMapRoundTrip(t *testing.T) {
+	for _, diskMap := range []string{exampleDiskMap, "12345", "101", "90909"} {
+		fileSys := parseDiskMap(t, []byte(diskMap))
+		if actual, err := fileSys.DiskMap(); err != nil || actual != diskMap {
+			t.Errorf("%s: serialised as %q (error %v)", diskMap, actual, err)
+		}
+	}
+}
+
+func TestExampleBlocks(t *testing.T) {
+	const before = "00...111...2...333.44.5555.6666.777.888899"
+
+	compacted := parseDiskMap(t, []byte(exampleDiskMap))
+	if actual := BlockString(compacted.Blocks()); actual != before {
+		t.Errorf("before compaction: got %s, expected %s", actual, before)
+	}
+	Compact(&compacted)
+	if actual, expected := BlockString(compacted.Blocks()), "0099811188827773336446555566.............."; actual != expected {
+		t.Errorf("after compaction: got %s, expected %s", actual, expected)
+	}
+	if checksum := CalculateChecksum(compacted); checksum != 1928 {
+		t.Errorf("compacted checksum %d, expected 1928", checksum)
+	}
+
+	defragged := parseDiskMap(t, []byte(exampleDiskMap))
+	Defrag(&defragged, FirstFit)
+	if actual, expected := BlockString(defragged.Blocks()), "00992111777.44.333....5555.6666.....8888.."; actual != expected {
+		t.Errorf("after defrag: got %s, expected %s", actual, expected)
+	}
+	if checksum := CalculateChecksum(defragged); checksum != 2858 {
+		t.Errorf("defragged checksum %d, expected 2858", checksum)
+	}
+}
+
+/**
+ * Fuzzes the rearrangements with inputs in every format, validating the list after every move. Inputs
+ * that don't parse, or that are too large to compare block by block, are skipped.
+ */
+func FuzzDefrag(f *testing.F) {
+	formats := []string{"digits", "sizes", "json"}
+	f.Add([]byte(exampleDiskMap), uint8(0))
+	f.Add([]byte("12345"), uint8(0))
+	f.Add([]byte("2 3 3 3 1 3 3 1 2 1 4 1 4 1 3 1 4 0 2"), uint8(1))
+	f.Add([]byte("12 30 5 0 17 2 8"), uint8(1))
+	f.Add([]byte(`[{"id":7,"size":12,"free":3},{"id":2,"size":1,"free":14},{"id":40,"size":11}]`), uint8(2))
+
+	f.Fuzz(func(t *testing.T, input []byte, formatIndex uint8) {
+		format := formats[int(formatIndex)%len(formats)]
+		fileSys, err := ParseFileSystem(input, format)
+		if err != nil || fileSys.size > 1<<16 {
+			t.Skip()
+		}
+		// Keep checksums well clear of overflow, where the two ways of calculating them differ.
+		for f := fileSys.start; f != nil; f = f.next {
+			if f.id > 1<<16 {
+				t.Skip()
+			}
+		}
+
+		if err := CheckRearrangements(input, format); err != nil {
+			t.Errorf("%s input %q: %v", format, input, err)
+		}
+	})
+}
+
+func TestWriteDiffWidth(t *testing.T) {
+	fileSys := parseDiskMap(t, []byte(exampleDiskMap))
+	before := fileSys.Blocks()
+	Compact(&fileSys)
+
+	for _, width := range []int{0, -1} {
+		if err := WriteDiff(io.Discard, before, fileSys.Blocks(), width); err == nil {
+			t.Errorf("width %d: expected an error", width)
+		}
+	}
+	if err := WriteDiff(io.Discard, before, fileSys.Blocks(), 1); err != nil {
+		t.Errorf("width 1: %v", err)
+	}
+}
+
+func TestValidateCatchesLostBlocks(t *testing.T) {
+	fileSys := parseDiskMap(t, []byte(exampleDiskMap))
+	Compact(&fileSys)
+	if err := fileSys.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Turn a block of the first file into free space. The addresses and disk size still add up.
+	fileSys.start.length--
+	fileSys.start.freeSpace++
+	if err := fileSys.Validate(); err == nil {
+		t.Error("expected a lost block to be reported")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/**
+ * Decides where Defrag moves each file. Take removes and returns the node whose free span the file
+ * should move into, or nil if the file should stay where it is; the span must start before the file.
+ * Add is told about the node holding a file after it moves, so any space the file didn't use can be
+ * offered to later files.
+ */
+type Placement interface {
+	Take(file *FileNode) *FileNode
+	Add(node *FileNode)
+}
+
+/**
+ * Builds a placement for the free spans of a file system, before any files have moved.
+ */
+type PlacementStrategy func(fileSys *FileSystem) Placement
+
+/**
+ * The puzzle's placement: the left-most span that the file fits in.
+ */
+func FirstFit(fileSys *FileSystem) Placement {
+	return NewFreeSpanIndex(fileSys)
+}
+
+/**
+ * The smallest span that the file fits in, taking the left-most of equally small spans.
+ */
+func BestFit(fileSys *FileSystem) Placement {
+	return scanFit{fileSys, func(candidate, best *FileNode) bool { return candidate.freeSpace < best.freeSpace }}
+}
+
+/**
+ * The largest span before the file, taking the left-most of equally large spans.
+ */
+func WorstFit(fileSys *FileSystem) Placement {
+	return scanFit{fileSys, func(candidate, best *FileNode) bool { return candidate.freeSpace > best.freeSpace }}
+}
+
+/**
+ * Finds a span by walking the list up to the file and keeping the span that the better function
+ * prefers. The list itself is always up to date, so there is nothing to do when a file moves.
+ */
+type scanFit struct {
+	fileSys *FileSystem
+	better  func(candidate, best *FileNode) bool
+}
+
+func (placement scanFit) Take(file *FileNode) *FileNode {
+	var best *FileNode
+	for f := placement.fileSys.start; f != nil && f.address+f.length < file.address; f = f.next {
+		if f.freeSpace >= max(file.length, 1) && (best == nil || placement.better(f, best)) {
+			best = f
+		}
+	}
+
+	return best
+}
+
+func (placement scanFit) Add(node *FileNode) {}
+
+/**
+ * Counts the gaps left between files: the free spans that have a (non-empty) file after them, and the
+ * number of free blocks in them.
+ */
+func Fragmentation(fileSys *FileSystem) (gaps int, blocks int) {
+	lastFile := fileSys.end
+	for lastFile != nil && lastFile.length == 0 {
+		lastFile = lastFile.prev
+	}
+
+	for f := fileSys.start; f != nil && f != lastFile; f = f.next {
+		if f.freeSpace > 0 {
+			gaps++
+			blocks += f.freeSpace
+		}
+	}
+
+	return gaps, blocks
+}
+
+/**
+ * A named way of defragging a file system, which returns the number of files it moved.
+ */
+type DefragStrategy struct {
+	name   string
+	defrag func(fileSys *FileSystem) int
+}
+
+var DefragStrategies = []DefragStrategy{
+	{"first-fit", func(fileSys *FileSystem) int { return Defrag(fileSys, FirstFit) }},
+	{"best-fit", func(fileSys *FileSystem) int { return Defrag(fileSys, BestFit) }},
+	{"worst-fit", func(fileSys *FileSystem) int { return Defrag(fileSys, WorstFit) }},
+	{"repeated", func(fileSys *FileSystem) int { return DefragRepeated(fileSys, FirstFit) }},
+}
+
+func FindStrategy(name string) (DefragStrategy, error) {
+	for _, strategy := range DefragStrategies {
+		if strategy.name == name {
+			return strategy, nil
+		}
+	}
+
+	names := make([]string, len(DefragStrategies))
+	for i, strategy := range DefragStrategies {
+		names[i] = strategy.name
+	}
+	return DefragStrategy{}, fmt.Errorf("unknown strategy %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+/**
+ * Defrags a fresh copy of the input with every strategy and writes a table of the checksum, number of
+ * files moved and fragmentation that each one leaves.
+ */
+func CompareStrategies(w io.Writer, input []byte, format string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-10s %16s %8s %8s %12s\n", "Strategy", "Checksum", "Moves", "Gaps", "Gap blocks")
+	for _, strategy := range DefragStrategies {
+		fileSys, err := ParseFileSystem(input, format)
+		if err != nil {
+			return err
+		}
+
+		moves := strategy.defrag(&fileSys)
+		gaps, blocks := Fragmentation(&fileSys)
+		fmt.Fprintf(&sb, "%-10s %16d %8d %8d %12d\n", strategy.name, CalculateChecksum(fileSys), moves, gaps, blocks)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+/**
+ * Checks the invariants of the linked list: the prev and next pointers mirror each other, each node
+ * starts where the previous one's free space ends, no length is negative, the lengths and free space
+ * add up to the size of the disk, and every file ID appears exactly once. Block-level compaction
+ * splits files across several nodes, so once a file system has been compacted an ID may appear more
+ * than once, but the lengths of its nodes must still add up to the file's original length, so no
+ * blocks are lost or duplicated.
+ */
+func (fileSys *FileSystem) Validate() error {
+	if fileSys.start == nil || fileSys.end == nil {
+		if fileSys.start != fileSys.end {
+			return fmt.Errorf("only one of start and end is nil")
+		}
+		return nil
+	}
+	if fileSys.start.prev != nil {
+		return fmt.Errorf("start node (id %d) has a previous node", fileSys.start.id)
+	}
+
+	total := 0
+	seenIDs := make(map[int]bool)
+	lengths := make(map[int]int, len(fileSys.lengths))
+	var last *FileNode
+	for f := fileSys.start; f != nil; f = f.next {
+		if f.prev != last {
+			return fmt.Errorf("node at address %d (id %d): prev doesn't point at the node before it", f.address, f.id)
+		}
+		if f.length < 0 || f.freeSpace < 0 {
+			return fmt.Errorf("node at address %d (id %d): negative length %d or free space %d", f.address, f.id, f.length, f.freeSpace)
+		}
+		if f.address != total {
+			return fmt.Errorf("node at address %d (id %d): expected address %d", f.address, f.id, total)
+		}
+		if seenIDs[f.id] && !fileSys.splitFiles {
+			return fmt.Errorf("node at address %d: id %d appears more than once", f.address, f.id)
+		}
+
+		seenIDs[f.id] = true
+		lengths[f.id] += f.length
+		total += f.length + f.freeSpace
+		last = f
+	}
+
+	if last != fileSys.end {
+		return fmt.Errorf("end node (id %d) isn't the last node in the list (id %d)", fileSys.end.id, last.id)
+	}
+	if total != fileSys.size {
+		return fmt.Errorf("lengths and free space add up to %d, but the disk size is %d", total, fileSys.size)
+	}
+	for id, length := range fileSys.lengths {
+		if lengths[id] != length {
+			return fmt.Errorf("file %d has %d blocks, but started with %d", id, lengths[id], length)
+		}
+	}
+	for id := range lengths {
+		if _, ok := fileSys.lengths[id]; !ok {
+			return fmt.Errorf("id %d isn't one of the disk's files", id)
+		}
+	}
+
+	return nil
+}
+
+/**
+ * Validates the file system after a move when it is in debug mode, panicking on the first problem.
+ */
+func (fileSys *FileSystem) CheckMove() {
+	if !fileSys.debug {
+		return
+	}
+
+	if err := fileSys.Validate(); err != nil {
+		panic(fmt.Sprintf("File system invalid after a move: %v", err))
+	}
+}
+
+/**
+ * A direct implementation of block-level compaction over an array of blocks, for comparison.
+ */
+func CompactBlockArray(blocks []int) []int {
+	compacted := append([]int(nil), blocks...)
+	left, right := 0, len(compacted)-1
+	for {
+		for left < right && compacted[left] != freeBlock {
+			left++
+		}
+		for left < right && compacted[right] == freeBlock {
+			right--
+		}
+		if left >= right {
+			return compacted
+		}
+		compacted[left], compacted[right] = compacted[right], freeBlock
+	}
+}
+
+func BlockChecksum(blocks []int) int {
+	checkSum := 0
+	for position, id := range blocks {
+		if id != freeBlock {
+			checkSum += position * id
+		}
+	}
+
+	return checkSum
+}
+
+/**
+ * Runs block compaction and every defrag strategy over fresh copies of the input in debug mode, so
+ * that the list is validated after every move. The results are also checked against each other:
+ * compaction against CompactBlockArray, and first-fit Defrag against DefragLinear. Panics during the
+ * rearrangements are returned as errors.
+ */
+func CheckRearrangements(input []byte, format string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	parse := func() FileSystem {
+		fileSys, err := ParseFileSystem(input, format)
+		Check(err)
+		fileSys.debug = true
+		return fileSys
+	}
+
+	compacted := parse()
+	expected := BlockChecksum(CompactBlockArray(compacted.Blocks()))
+	Compact(&compacted)
+	if actual := CalculateChecksum(compacted); actual != expected {
+		return fmt.Errorf("compacted checksum %d, expected %d", actual, expected)
+	}
+
+	// Every strategy must keep the list valid; first-fit's result is also checked below.
+	for _, strategy := range DefragStrategies {
+		fileSys := parse()
+		strategy.defrag(&fileSys)
+	}
+
+	defragged := parse()
+	Defrag(&defragged, FirstFit)
+	linear := parse()
+	DefragLinear(&linear)
+	if actual, expected := CalculateChecksum(defragged), CalculateChecksum(linear); actual != expected {
+		return fmt.Errorf("defragged checksum %d, expected %d", actual, expected)
+	}
+
+	return nil
+}
+
+/**
+ * Checks the rearrangements of random disk maps, returning the first failure found.
+ */
+func Fuzz(runs int, maxDigits int, seed uint64) error {
+	if maxDigits < 1 {
+		return fmt.Errorf("random disk maps need at least 1 digit, not %d", maxDigits)
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	for run := range runs {
+		diskMap := make([]byte, 1+rng.IntN(maxDigits))
+		for i := range diskMap {
+			diskMap[i] = byte('0' + rng.IntN(10))
+		}
+
+		if err := CheckRearrangements(diskMap, "digits"); err != nil {
+			return fmt.Errorf("run %d, disk map %s: %v", run, diskMap, err)
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"iter"
@@ -20,6 +21,10 @@ type Vector struct {
 	y int
 }
 
+func (vec Vector) String() string {
+	return fmt.Sprintf("(%d,%d)", vec.x, vec.y)
+}
+
 func (vec Vector) Add(other Vector) Vector {
 	return Vector{vec.x + other.x, vec.y + other.y}
 }
@@ -28,11 +33,12 @@ func (grid *Grid) InBounds(point Vector) bool {
 	return point.x >= 0 && point.x < grid.width && point.y >= 0 && point.y < grid.height
 }
 
-func PopulateMapFromReader(r *bufio.Reader) (*Grid, []Vector) {
+/**
+ * Reads a height map. Tiles are single-digit heights, or '.' for tiles that can't be walked on.
+ */
+func PopulateMapFromReader(r *bufio.Reader) *Grid {
 	grid := Grid{contents: make([]int, 0, 128), width: 0, height: 0}
-	zeroes := make([]Vector, 0, 20)
 
-	chCount := 0
 	for {
 		ch, _, err := r.ReadRune()
 		ch = rune(ch)
@@ -43,16 +49,16 @@ func PopulateMapFromReader(r *bufio.Reader) (*Grid, []Vector) {
 		}
 
 		if ch == '\n' {
-			chCount = 0
 			grid.height++
 			continue
-		} else if ch == '0' {
-			zeroes = append(zeroes, Vector{chCount, grid.height})
 		}
 
-		num, err := strconv.Atoi(string(ch))
-		if err != nil {
-			panic(err)
+		num := IMPASSABLE
+		if ch != '.' {
+			num, err = strconv.Atoi(string(ch))
+			if err != nil {
+				panic(err)
+			}
 		}
 		grid.contents = append(grid.contents, num)
 
@@ -60,29 +66,49 @@ func PopulateMapFromReader(r *bufio.Reader) (*Grid, []Vector) {
 		if grid.height == 0 {
 			grid.width++
 		}
-		chCount++
 	}
 
-	return &grid, zeroes
+	return &grid
+}
+
+/**
+ * Returns the cells at the start height of the rules, in reading order.
+ */
+func (grid *Grid) Trailheads(rules *Rules) []Vector {
+	trailheads := make([]Vector, 0, 20)
+	for i, height := range grid.contents {
+		if height == rules.startHeight {
+			trailheads = append(trailheads, grid.Point(i))
+		}
+	}
+
+	return trailheads
+}
+
+func (grid *Grid) Index(point Vector) int {
+	return point.y*grid.width + point.x
+}
+
+func (grid *Grid) Point(index int) Vector {
+	return Vector{index % grid.width, index / grid.width}
 }
 
 func (grid *Grid) Get(point Vector) int {
-	return grid.contents[point.y*grid.width+point.x]
+	return grid.contents[grid.Index(point)]
 }
 
 /**
- * Yields all adjacent cells that can be pathed to from the given point.
+ * Yields all adjacent cells that the rules allow a trail to step to from the given point.
  */
-func (mapData *Grid) Neighbours(point Vector) iter.Seq[Vector] {
+func (mapData *Grid) Neighbours(point Vector, rules *Rules) iter.Seq[Vector] {
 	return func(yield func(Vector) bool) {
-		checkDirn := []Vector{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}
-		for _, dir := range checkDirn {
+		for _, dir := range rules.Directions() {
 			neighbour := point.Add(dir)
 			if !mapData.InBounds(neighbour) {
 				continue
 			}
 
-			canPath := (mapData.Get(neighbour) - mapData.Get(point)) == 1
+			canPath := rules.CanStep(mapData.Get(point), mapData.Get(neighbour))
 			if canPath && !yield(neighbour) {
 				return
 			}
@@ -90,7 +116,11 @@ func (mapData *Grid) Neighbours(point Vector) iter.Seq[Vector] {
 	}
 }
 
-func FindPaths(zeroLoc Vector, mapData *Grid) (int, int) {
+/**
+ * Finds the score and rating of a trailhead by following every trail from it in turn. This takes time
+ * proportional to the number of trails, so CountTrails is used instead; this is kept to check it.
+ */
+func FindPaths(zeroLoc Vector, mapData *Grid, rules *Rules) (int, int) {
 	frontier := make([]Vector, 0, 4) // Contains the cells that are queued for checking.
 	ninesSet := make(map[Vector]bool)
 	nines := 0
@@ -100,11 +130,12 @@ func FindPaths(zeroLoc Vector, mapData *Grid) (int, int) {
 		// Pop the first cell to check from the queue.
 		current := frontier[0]
 		frontier = frontier[1:]
-		for next := range mapData.Neighbours(current) {
-			frontier = append(frontier, next)
-			if mapData.Get(next) == 9 {
+		for next := range mapData.Neighbours(current, rules) {
+			if mapData.Get(next) == rules.endHeight {
 				ninesSet[next] = true
 				nines++
+			} else {
+				frontier = append(frontier, next)
 			}
 		}
 	}
@@ -113,19 +144,69 @@ func FindPaths(zeroLoc Vector, mapData *Grid) (int, int) {
 }
 
 func main() {
-	file, err := os.Open("./input.txt")
+	verify := flag.Bool("verify", false, "cross-check the trail counts against following every trail")
+	trailhead := flag.Int("trailhead", -1, "list the trails from this trailhead, numbered in reading order from 0")
+	limit := flag.Int("limit", 0, "the most trails to list, or 0 for all of them")
+	show := flag.Int("show", -1, "draw this trail, numbered from 0, over the map instead of listing the trails")
+	colour := flag.Bool("colour", false, "draw the whole map, with the trail highlighted in ANSI colours")
+	input := flag.String("input", "./input.txt", "the height map to read")
+	minStep := flag.Int("min-step", 1, "the smallest height change allowed in a step")
+	maxStep := flag.Int("max-step", 1, "the largest height change allowed in a step")
+	diagonal := flag.Bool("diagonal", false, "allow trails to step diagonally")
+	startHeight := flag.Int("start", 0, "the height that trails start at")
+	endHeight := flag.Int("end", 9, "the height that trails end at")
+	flag.Parse()
+
+	rules, err := NewRules(*minStep, *maxStep, *diagonal, *startHeight, *endHeight)
+	if err != nil {
+		panic(err)
+	}
+
+	file, err := os.Open(*input)
 	if err != nil {
 		panic(err)
 	}
 	defer file.Close()
 
 	reader := bufio.NewReader(file)
-	hikingMap, zeroes := PopulateMapFromReader(reader)
+	hikingMap := PopulateMapFromReader(reader)
+	trailheads := hikingMap.Trailheads(&rules)
+
+	if *trailhead >= 0 {
+		if *trailhead >= len(trailheads) {
+			panic(fmt.Sprintf("Trailhead %d doesn't exist, the map has %d", *trailhead, len(trailheads)))
+		}
+		start := trailheads[*trailhead]
 
+		if *show >= 0 {
+			trail, ok := NthTrail(hikingMap, &rules, start, *show)
+			if !ok {
+				panic(fmt.Sprintf("Trailhead %d has fewer than %d trails", *trailhead, *show+1))
+			}
+			if err := RenderTrail(os.Stdout, hikingMap, trail, *colour); err != nil {
+				panic(err)
+			}
+			return
+		}
+
+		i := 0
+		for trail := range Trails(hikingMap, &rules, start, *limit) {
+			fmt.Printf("%4d: %v\n", i, trail)
+			i++
+		}
+		return
+	}
+
+	counts := CountTrails(hikingMap, &rules)
 	totalScore := 0
 	totalRating := 0
-	for _, z := range zeroes {
-		score, rating := FindPaths(z, hikingMap)
+	for _, z := range trailheads {
+		score, rating := counts.Score(hikingMap, z), counts.Rating(hikingMap, z)
+		if *verify {
+			if expectedScore, expectedRating := FindPaths(z, hikingMap, &rules); score != expectedScore || rating != expectedRating {
+				panic(fmt.Sprintf("Trailhead %v: counted score %d and rating %d, expected %d and %d", z, score, rating, expectedScore, expectedRating))
+			}
+		}
 		totalScore += score
 		totalRating += rating
 	}
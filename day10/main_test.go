@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var examples = []struct {
+	name   string
+	rows   []string
+	score  int // The totals over every trailhead.
+	rating int
+}{
+	{"two nines", []string{
+		"...0...",
+		"...1...",
+		"...2...",
+		"6543456",
+		"7.....7",
+		"8.....8",
+		"9.....9",
+	}, 2, 2},
+	{"four nines", []string{
+		"..90..9",
+		"...1.98",
+		"...2..7",
+		"6543456",
+		"765.987",
+		"876....",
+		"987....",
+	}, 4, 13},
+	{"two trailheads", []string{
+		"10..9..",
+		"2...8..",
+		"3...7..",
+		"4567654",
+		"...8..3",
+		"...9..2",
+		".....01",
+	}, 3, 3},
+	{"three trails", []string{
+		".....0.",
+		"..4321.",
+		"..5..2.",
+		"..6543.",
+		"..7..4.",
+		"..8765.",
+		"..9....",
+	}, 1, 3},
+	{"many trails", []string{
+		"012345",
+		"123456",
+		"234567",
+		"345678",
+		"4.6789",
+		"56789.",
+	}, 2, 227},
+	{"larger", []string{
+		"89010123",
+		"78121874",
+		"87430965",
+		"96549874",
+		"45678903",
+		"32019012",
+		"01329801",
+		"10456732",
+	}, 36, 81},
+}
+
+func parseMap(t *testing.T, rows []string) *Grid {
+	t.Helper()
+
+	return PopulateMapFromReader(bufio.NewReader(strings.NewReader(strings.Join(rows, "\n") + "\n")))
+}
+
+func TestCountTrails(t *testing.T) {
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			grid := parseMap(t, example.rows)
+			counts := CountTrails(grid, &PuzzleRules)
+
+			totalScore, totalRating := 0, 0
+			for _, trailhead := range grid.Trailheads(&PuzzleRules) {
+				score, rating := counts.Score(grid, trailhead), counts.Rating(grid, trailhead)
+				if expectedScore, expectedRating := FindPaths(trailhead, grid, &PuzzleRules); score != expectedScore || rating != expectedRating {
+					t.Errorf("trailhead %v: counted score %d and rating %d, FindPaths found %d and %d", trailhead, score, rating, expectedScore, expectedRating)
+				}
+				totalScore += score
+				totalRating += rating
+			}
+
+			if totalScore != example.score || totalRating != example.rating {
+				t.Errorf("total score %d and rating %d, expected %d and %d", totalScore, totalRating, example.score, example.rating)
+			}
+		})
+	}
+}
+
+func TestTrails(t *testing.T) {
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			grid := parseMap(t, example.rows)
+			counts := CountTrails(grid, &PuzzleRules)
+
+			for _, trailhead := range grid.Trailheads(&PuzzleRules) {
+				trails := make([][]Vector, 0)
+				for trail := range Trails(grid, &PuzzleRules, trailhead, 0) {
+					trails = append(trails, trail)
+				}
+				if rating := counts.Rating(grid, trailhead); len(trails) != rating {
+					t.Errorf("trailhead %v: %d trails, but its rating is %d", trailhead, len(trails), rating)
+				}
+
+				// Each trail is kept after the next is yielded, so they would all match if they shared memory.
+				seen := make(map[string]bool, len(trails))
+				for _, trail := range trails {
+					if len(trail) != 10 || trail[0] != trailhead || grid.Get(trail[9]) != 9 {
+						t.Fatalf("trailhead %v: %v isn't a trail from the trailhead to a nine", trailhead, trail)
+					}
+					for i := 1; i < len(trail); i++ {
+						if !PuzzleRules.CanStep(grid.Get(trail[i-1]), grid.Get(trail[i])) {
+							t.Fatalf("trailhead %v: %v can't step from %v to %v", trailhead, trail, trail[i-1], trail[i])
+						}
+					}
+					if key := fmt.Sprint(trail); seen[key] {
+						t.Errorf("trailhead %v: %v yielded more than once", trailhead, trail)
+					} else {
+						seen[key] = true
+					}
+				}
+
+				for _, limit := range []int{1, 2} {
+					yielded := 0
+					for range Trails(grid, &PuzzleRules, trailhead, limit) {
+						yielded++
+					}
+					if expected := min(limit, len(trails)); yielded != expected {
+						t.Errorf("trailhead %v, limit %d: %d trails yielded, expected %d", trailhead, limit, yielded, expected)
+					}
+				}
+
+				if len(trails) > 0 {
+					if nth, ok := NthTrail(grid, &PuzzleRules, trailhead, len(trails)-1); !ok || !slices.Equal(nth, trails[len(trails)-1]) {
+						t.Errorf("trailhead %v: last trail %v, NthTrail gave %v", trailhead, trails[len(trails)-1], nth)
+					}
+				}
+				if _, ok := NthTrail(grid, &PuzzleRules, trailhead, len(trails)); ok {
+					t.Errorf("trailhead %v: NthTrail found a trail past the last one", trailhead)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/**
+ * Writes the height map with a trail overlaid. Without colour, only the heights along the trail are
+ * drawn and every other cell is drawn as '.', as in the puzzle's examples. With colour, the whole map
+ * is drawn, with impassable tiles as '.', and the trail is shown in bold green.
+ */
+func RenderTrail(w io.Writer, grid *Grid, trail []Vector, colour bool) error {
+	onTrail := make(map[Vector]bool, len(trail))
+	for _, point := range trail {
+		onTrail[point] = true
+	}
+
+	var sb strings.Builder
+	for y := range grid.height {
+		for x := range grid.width {
+			point := Vector{x, y}
+			switch {
+			case onTrail[point] && colour:
+				fmt.Fprintf(&sb, "\x1b[1;32m%d\x1b[0m", grid.Get(point))
+			case grid.Get(point) == IMPASSABLE:
+				sb.WriteByte('.')
+			case onTrail[point] || colour:
+				fmt.Fprintf(&sb, "%d", grid.Get(point))
+			default:
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
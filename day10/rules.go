@@ -0,0 +1,81 @@
+package main
+
+import "fmt"
+
+/**
+ * The height stored for '.' tiles, which trails can't pass through.
+ */
+const IMPASSABLE = -1
+
+var orthogonal = []Vector{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}
+var eightWay = []Vector{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+
+/**
+ * What makes a hiking trail. The puzzle's trails start at height 0, end at height 9, and climb by
+ * exactly 1 with each orthogonal step. Trails may instead climb (or descend) by any amount within a
+ * range, and may step diagonally. Every step must head towards the end height, which keeps trails
+ * finite and lets CountTrails work through the heights in order.
+ */
+type Rules struct {
+	minStep     int // The smallest and largest height change allowed in a step, inclusive.
+	maxStep     int
+	diagonal    bool
+	startHeight int
+	endHeight   int
+}
+
+var PuzzleRules = Rules{minStep: 1, maxStep: 1, diagonal: false, startHeight: 0, endHeight: 9}
+
+func NewRules(minStep int, maxStep int, diagonal bool, startHeight int, endHeight int) (Rules, error) {
+	rules := Rules{minStep: minStep, maxStep: maxStep, diagonal: diagonal, startHeight: startHeight, endHeight: endHeight}
+	switch {
+	case startHeight < 0 || startHeight > 9 || endHeight < 0 || endHeight > 9:
+		return Rules{}, fmt.Errorf("start and end heights must be between 0 and 9, not %d and %d", startHeight, endHeight)
+	case minStep > maxStep:
+		return Rules{}, fmt.Errorf("smallest step %d is larger than the largest step %d", minStep, maxStep)
+	case startHeight < endHeight && minStep < 1:
+		return Rules{}, fmt.Errorf("trails from %d up to %d must climb with every step, but the smallest step is %d", startHeight, endHeight, minStep)
+	case startHeight > endHeight && maxStep > -1:
+		return Rules{}, fmt.Errorf("trails from %d down to %d must descend with every step, but the largest step is %d", startHeight, endHeight, maxStep)
+	case startHeight == endHeight:
+		return Rules{}, fmt.Errorf("trails must start and end at different heights")
+	}
+
+	return rules, nil
+}
+
+func (rules *Rules) Directions() []Vector {
+	if rules.diagonal {
+		return eightWay
+	}
+
+	return orthogonal
+}
+
+/**
+ * Reports whether a trail can step between cells of the given heights.
+ */
+func (rules *Rules) CanStep(from int, to int) bool {
+	if from == IMPASSABLE || to == IMPASSABLE {
+		return false
+	}
+
+	change := to - from
+	return change >= rules.minStep && change <= rules.maxStep
+}
+
+/**
+ * Lists the heights a trail can pass through, from its end back to its start.
+ */
+func (rules *Rules) HeightsFromEnd() []int {
+	heights := make([]int, 0, 10)
+	dir := 1
+	if rules.endHeight > rules.startHeight {
+		dir = -1
+	}
+	for height := rules.endHeight; height != rules.startHeight+dir; height += dir {
+		heights = append(heights, height)
+	}
+
+	return heights
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"iter"
+	"math/bits"
+)
+
+type Bitset []uint64
+
+func NewBitset(size int) Bitset {
+	return make(Bitset, (size+63)/64)
+}
+
+func (set Bitset) Set(i int) {
+	set[i/64] |= 1 << (i % 64)
+}
+
+func (set Bitset) Union(other Bitset) {
+	for i, word := range other {
+		set[i] |= word
+	}
+}
+
+func (set Bitset) Count() int {
+	count := 0
+	for _, word := range set {
+		count += bits.OnesCount64(word)
+	}
+
+	return count
+}
+
+/**
+ * The trails leading on from every cell of a map: the set of trail ends that can be reached from the
+ * cell, with the ends numbered in reading order, and the number of distinct trails that reach them.
+ * Cells that no trail passes through are left with a nil set.
+ */
+type TrailCounts struct {
+	ends   []Bitset
+	trails []int
+}
+
+/**
+ * Counts the trails from every cell at once, working back from the trail ends. A cell's ends are the
+ * union of those of the cells one step on from it, and its trails are the sum of theirs, so each cell
+ * is visited once however many trails pass through it. Every step heads towards the end height, so
+ * the cells one step on have always been counted first.
+ */
+func CountTrails(grid *Grid, rules *Rules) *TrailCounts {
+	var byHeight [10][]int
+	for i, height := range grid.contents {
+		if height != IMPASSABLE {
+			byHeight[height] = append(byHeight[height], i)
+		}
+	}
+
+	heights := rules.HeightsFromEnd()
+	numEnds := len(byHeight[rules.endHeight])
+	counts := TrailCounts{ends: make([]Bitset, len(grid.contents)), trails: make([]int, len(grid.contents))}
+	for bit, i := range byHeight[rules.endHeight] {
+		counts.ends[i] = NewBitset(numEnds)
+		counts.ends[i].Set(bit)
+		counts.trails[i] = 1
+	}
+
+	for _, height := range heights[1:] {
+		for _, i := range byHeight[height] {
+			counts.ends[i] = NewBitset(numEnds)
+			for next := range grid.Neighbours(grid.Point(i), rules) {
+				// Steps past the end height lead nowhere, and their cells are never counted.
+				counts.ends[i].Union(counts.ends[grid.Index(next)])
+				counts.trails[i] += counts.trails[grid.Index(next)]
+			}
+		}
+	}
+
+	return &counts
+}
+
+/**
+ * The number of trail ends that can be reached from the point.
+ */
+func (counts *TrailCounts) Score(grid *Grid, point Vector) int {
+	return counts.ends[grid.Index(point)].Count()
+}
+
+/**
+ * The number of distinct trails from the point to a trail end.
+ */
+func (counts *TrailCounts) Rating(grid *Grid, point Vector) int {
+	return counts.trails[grid.Index(point)]
+}
+
+/**
+ * Yields each distinct trail from the trailhead to a trail end, as the points along it, stopping after
+ * limit trails if limit is positive. Trails are found depth-first as they are asked for, so taking
+ * the first few is cheap however many there are. Each trail is a new slice that the caller may keep.
+ */
+func Trails(grid *Grid, rules *Rules, trailhead Vector, limit int) iter.Seq[[]Vector] {
+	return func(yield func([]Vector) bool) {
+		found := 0
+		trail := []Vector{trailhead}
+
+		var follow func(point Vector) bool
+		follow = func(point Vector) bool {
+			if grid.Get(point) == rules.endHeight {
+				found++
+				return yield(append([]Vector(nil), trail...)) && (limit <= 0 || found < limit)
+			}
+
+			for next := range grid.Neighbours(point, rules) {
+				trail = append(trail, next)
+				more := follow(next)
+				trail = trail[:len(trail)-1]
+				if !more {
+					return false
+				}
+			}
+
+			return true
+		}
+
+		follow(trailhead)
+	}
+}
+
+/**
+ * Returns the nth trail, counting from 0, in the order that Trails yields them.
+ */
+func NthTrail(grid *Grid, rules *Rules, trailhead Vector, n int) ([]Vector, bool) {
+	i := 0
+	for trail := range Trails(grid, rules, trailhead, n+1) {
+		if i == n {
+			return trail, true
+		}
+		i++
+	}
+
+	return nil, false
+}